@@ -1,7 +1,11 @@
 package main
 
 import (
+	"net/http"
 	"os"
+	"strings"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
 )
 
 func (cfg apiConfig) ensureDirs() error {
@@ -21,7 +25,57 @@ func (cfg apiConfig) ensureAssetsDir() error {
 
 func (cfg apiConfig) ensureTempDir() error {
 	if _, err := os.Stat(cfg.tempRoot); os.IsNotExist(err) {
-		return os.Mkdir(cfg.tempRoot, 0755)
+		if err := os.Mkdir(cfg.tempRoot, 0755); err != nil {
+			return err
+		}
+	}
+	// Pliki robocze enkodera zawsze są lokalne, nawet gdy poczekalnia leży w S3
+	return os.MkdirAll(cfg.scratchDir(), 0755)
+}
+
+// openStores tworzy magazyny poczekalni i zasobów według STORAGE_DRIVER.
+// Cache wyników i dane uploadów tus zawsze zostają na lokalnym dysku.
+func (cfg *apiConfig) openStores() error {
+	switch cfg.storageDriver {
+	case "s3":
+		staging := cfg.s3Config
+		staging.Prefix = "staging/"
+		s, err := storage.NewS3(staging)
+		if err != nil {
+			return err
+		}
+		assets := cfg.s3Config
+		assets.Prefix = "assets/"
+		a, err := storage.NewS3(assets)
+		if err != nil {
+			return err
+		}
+		cfg.staging, cfg.assets = s, a
+	default:
+		s, err := storage.NewLocal(cfg.tempRoot)
+		if err != nil {
+			return err
+		}
+		a, err := storage.NewLocal(cfg.assetsRoot)
+		if err != nil {
+			return err
+		}
+		cfg.staging, cfg.assets = s, a
 	}
 	return nil
 }
+
+// assetsHandler serwuje publiczne zasoby z magazynu (bez listowania katalogów)
+func (cfg *apiConfig) assetsHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := storage.CleanKey(r.PathValue("path"))
+	if err != nil || strings.HasSuffix(r.PathValue("path"), "/") {
+		http.NotFound(w, r)
+		return
+	}
+	// Cache przetworzonych plików i zachowane oryginały nie są publiczne
+	if first, _, _ := strings.Cut(key, "/"); first == "cache" || first == "originals" {
+		http.NotFound(w, r)
+		return
+	}
+	serveObject(w, r, cfg.assets, key)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Wersja potoku przetwarzania - zwiększ przy każdej zmianie, która wpływa
+// na wynikowy plik WebP, żeby stare wpisy w cache przestały pasować.
+const pipelineVersion = 1
+
+const defaultCacheMaxBytes = 2 << 30 // 2 GB
+
+// outputCache przechowuje zakodowane pliki WebP adresowane treścią źródła,
+// potokiem i jego wersją. Usuwa najdawniej używane wpisy po przekroczeniu limitu.
+type outputCache struct {
+	root     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+func newOutputCache(root string, maxBytes int64) (*outputCache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create cache directory: %w", err)
+	}
+	c := &outputCache{
+		root:     root,
+		maxBytes: maxBytes,
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		c.size += e.size
+	}
+	return c, nil
+}
+
+// cacheMeta to metryki wyniku zapisywane obok wpisu - przy trafieniu
+// w cache nie ma czego z czym porównać, więc trzeba je zachować
+type cacheMeta struct {
+	SSIM    float64 `json:"ssim"`
+	Quality float32 `json:"quality"`
+}
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// hashSource liczy SHA-256 źródła i przewija je z powrotem na początek
+func hashSource(r io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("couldn't hash source: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("couldn't rewind source: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// key buduje klucz wpisu z hasha źródła, odcisku potoku (kroki + parametry
+// presetu) i wersji kodu przetwarzania
+func (c *outputCache) key(sourceHash, pipelineFingerprint string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|v%d", sourceHash, pipelineFingerprint, pipelineVersion)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *outputCache) path(key string) string {
+	return filepath.Join(c.root, key[:2], key+".webp")
+}
+
+func metaPath(entryPath string) string {
+	return strings.TrimSuffix(entryPath, ".webp") + ".json"
+}
+
+// get kopiuje wpis do dst. Zwraca false, jeśli wpisu nie ma w cache.
+func (c *outputCache) get(key, dst string) (cacheMeta, bool, error) {
+	src := c.path(key)
+	var meta cacheMeta
+	data, err := os.ReadFile(metaPath(src))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cacheMeta{}, false, nil
+		}
+		return cacheMeta{}, false, fmt.Errorf("couldn't read cache metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return cacheMeta{}, false, fmt.Errorf("couldn't parse cache metadata: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cacheMeta{}, false, nil
+		}
+		return cacheMeta{}, false, fmt.Errorf("couldn't open cache entry: %w", err)
+	}
+	defer in.Close()
+
+	if err := copyToFile(in, dst); err != nil {
+		return cacheMeta{}, false, err
+	}
+
+	// Odśwież czas modyfikacji - na nim opiera się kolejność LRU
+	now := time.Now()
+	if err := os.Chtimes(src, now, now); err != nil {
+		log.Printf("Cache: couldn't touch %s: %v", src, err)
+	}
+	return meta, true, nil
+}
+
+// put zapisuje kopię pliku src pod kluczem i w razie potrzeby zwalnia miejsce
+func (c *outputCache) put(key, src string, meta cacheMeta) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("couldn't open cache source: %w", err)
+	}
+	defer in.Close()
+
+	dst := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("couldn't create cache directory: %w", err)
+	}
+
+	// Zapis do pliku tymczasowego + rename, żeby równoległe workery
+	// nigdy nie zobaczyły niepełnego wpisu
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("couldn't create cache entry: %w", err)
+	}
+	written, err := io.Copy(tmp, in)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("couldn't write cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var previous int64
+	if info, err := os.Stat(dst); err == nil {
+		previous = info.Size()
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("couldn't store cache entry: %w", err)
+	}
+	c.size += written - previous
+
+	// Metadane zapisywane po pliku - get traktuje ich brak jako brak wpisu
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("couldn't encode cache metadata: %w", err)
+	}
+	if err := os.WriteFile(metaPath(dst), data, 0644); err != nil {
+		return fmt.Errorf("couldn't write cache metadata: %w", err)
+	}
+
+	if c.size > c.maxBytes {
+		c.evict()
+	}
+	return nil
+}
+
+// evict usuwa najdawniej używane wpisy aż rozmiar spadnie poniżej limitu.
+// Wywoływać z zablokowanym mu.
+func (c *outputCache) evict() {
+	entries, err := c.entries()
+	if err != nil {
+		log.Printf("Cache: couldn't list entries: %v", err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	for _, e := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+		os.Remove(metaPath(e.path))
+		if err := os.Remove(e.path); err != nil {
+			log.Printf("Cache: couldn't evict %s: %v", e.path, err)
+			continue
+		}
+		total -= e.size
+		log.Printf("Cache: usunięto %s (%d B)", filepath.Base(e.path), e.size)
+	}
+	c.size = total
+}
+
+func (c *outputCache) entries() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".webp" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, cacheEntry{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't walk cache directory: %w", err)
+	}
+	return entries, nil
+}
+
+func copyToFile(r io.Reader, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("couldn't create output file: %w", err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("couldn't copy file: %w", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// Plik .procreate to archiwum ZIP z warstwami w wewnętrznym formacie.
+// Spłaszczony podgląd całego płótna leży w QuickLook/Thumbnail.png.
+const procreateCompositeEntry = "quicklook/thumbnail.png"
+
+func decodeProcreate(r io.ReaderAt, size int64) (image.Image, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open Procreate archive: %w", err)
+	}
+
+	var composite *zip.File
+	for _, f := range archive.File {
+		name := strings.ToLower(f.Name)
+		if name == procreateCompositeEntry {
+			composite = f
+			break
+		}
+		// Starsze wersje mogą zapisywać podgląd pod inną nazwą w QuickLook/
+		if composite == nil && strings.HasPrefix(name, "quicklook/") &&
+			(strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".jpg")) {
+			composite = f
+		}
+	}
+	if composite == nil {
+		return nil, fmt.Errorf("procreate file has no embedded composite")
+	}
+
+	rc, err := composite.Open()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open Procreate composite: %w", err)
+	}
+	defer rc.Close()
+
+	img, _, err := image.Decode(rc)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode Procreate composite: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Dekoder spłaszczonego obrazu (merged image data) z plików PSD/PSB.
+// Warstwy są pomijane - kompozyt zapisuje Photoshop przy włączonej opcji
+// "Maximize Compatibility" (domyślnie włączona).
+
+const (
+	psdModeGrayscale = 1
+	psdModeIndexed   = 2
+	psdModeRGB       = 3
+	psdModeCMYK      = 4
+)
+
+const (
+	psdCompressionRaw = 0
+	psdCompressionRLE = 1
+)
+
+// Limity chronią przed plikami, które zajęłyby kilka GB pamięci po zdekodowaniu.
+// 300 000 px to maksymalny bok w formacie PSB.
+const (
+	maxPSDPixels = 100_000_000
+	maxPSDSide   = 300_000
+)
+
+// Płaszczyzny kanałów rosną razem z wczytanymi danymi, więc ucięty plik
+// z wielkimi wymiarami w nagłówku nie rezerwuje pamięci na zapas
+const psdPlaneChunk = 1 << 20
+
+type psdHeader struct {
+	Version   uint16
+	Reserved  [6]byte
+	Channels  uint16
+	Height    uint32
+	Width     uint32
+	Depth     uint16
+	ColorMode uint16
+}
+
+func decodePSD(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	var sig [4]byte
+	if _, err := io.ReadFull(br, sig[:]); err != nil || string(sig[:]) != "8BPS" {
+		return nil, fmt.Errorf("not a PSD file")
+	}
+	var h psdHeader
+	if err := binary.Read(br, binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("couldn't read PSD header: %w", err)
+	}
+	if h.Version != 1 && h.Version != 2 {
+		return nil, fmt.Errorf("unsupported PSD version %d", h.Version)
+	}
+	if h.Width == 0 || h.Height == 0 || h.Width > maxPSDSide || h.Height > maxPSDSide ||
+		uint64(h.Width)*uint64(h.Height) > maxPSDPixels {
+		return nil, fmt.Errorf("unsupported PSD dimensions %dx%d", h.Width, h.Height)
+	}
+	if h.Channels == 0 || h.Channels > 56 {
+		return nil, fmt.Errorf("invalid PSD channel count %d", h.Channels)
+	}
+	if h.Depth != 8 && h.Depth != 16 {
+		return nil, fmt.Errorf("unsupported PSD bit depth %d", h.Depth)
+	}
+	used, err := psdChannelsUsed(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// Color mode data - dla trybu indeksowanego zawiera paletę
+	palette, err := readPSDSection(br, false)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read PSD color mode data: %w", err)
+	}
+	// Image resources - pomijamy
+	if _, err := skipPSDSection(br, false); err != nil {
+		return nil, fmt.Errorf("couldn't skip PSD image resources: %w", err)
+	}
+	// Layer and mask information - w PSB długość jest 64-bitowa
+	if _, err := skipPSDSection(br, h.Version == 2); err != nil {
+		return nil, fmt.Errorf("couldn't skip PSD layers: %w", err)
+	}
+
+	channels, err := readPSDImageData(br, h, used)
+	if err != nil {
+		return nil, err
+	}
+	return psdToImage(h, channels, palette)
+}
+
+func readPSDSection(br *bufio.Reader, long bool) ([]byte, error) {
+	length, err := readPSDLength(br, long)
+	if err != nil {
+		return nil, err
+	}
+	if length > 1<<20 {
+		return nil, fmt.Errorf("section too large (%d bytes)", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func skipPSDSection(br *bufio.Reader, long bool) (int64, error) {
+	length, err := readPSDLength(br, long)
+	if err != nil {
+		return 0, err
+	}
+	return io.CopyN(io.Discard, br, int64(length))
+}
+
+func readPSDLength(br *bufio.Reader, long bool) (uint64, error) {
+	if long {
+		var n uint64
+		err := binary.Read(br, binary.BigEndian, &n)
+		return n, err
+	}
+	var n uint32
+	err := binary.Read(br, binary.BigEndian, &n)
+	return uint64(n), err
+}
+
+// psdChannelsUsed zwraca, ile pierwszych kanałów kompozytu potrzebuje psdToImage.
+// Pozostałe (kanały alfa, spot) są pomijane bez wczytywania do pamięci.
+func psdChannelsUsed(h psdHeader) (int, error) {
+	var need, want int
+	switch h.ColorMode {
+	case psdModeRGB:
+		need, want = 3, 4
+	case psdModeGrayscale, psdModeIndexed:
+		need, want = 1, 1
+	case psdModeCMYK:
+		need, want = 4, 4
+	default:
+		return 0, fmt.Errorf("unsupported PSD color mode %d", h.ColorMode)
+	}
+	if int(h.Channels) < need {
+		return 0, fmt.Errorf("PSD has %d channels, expected at least %d", h.Channels, need)
+	}
+	return min(int(h.Channels), want), nil
+}
+
+// readPSDImageData zwraca pierwsze used kanałów kompozytu w układzie planarnym,
+// po jednym bajcie na próbkę (z próbek 16-bitowych bierzemy starszy bajt - WebP
+// i tak jest 8-bitowy)
+func readPSDImageData(br *bufio.Reader, h psdHeader, used int) ([][]byte, error) {
+	var compression uint16
+	if err := binary.Read(br, binary.BigEndian, &compression); err != nil {
+		return nil, fmt.Errorf("couldn't read PSD compression: %w", err)
+	}
+
+	bytesPerSample := int(h.Depth / 8)
+	width := int(h.Width)
+	rowSize := width * bytesPerSample
+	height := int(h.Height)
+	row := make([]byte, rowSize)
+
+	// readRow wczytuje kolejny wiersz kanału c do row
+	var readRow func(c, y int) error
+	switch compression {
+	case psdCompressionRaw:
+		readRow = func(c, y int) error {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return fmt.Errorf("couldn't read PSD image data: %w", err)
+			}
+			return nil
+		}
+	case psdCompressionRLE:
+		counts, err := readPSDRowCounts(br, h, used, rowSize)
+		if err != nil {
+			return nil, err
+		}
+		var packed []byte
+		readRow = func(c, y int) error {
+			n := int(counts[c*height+y])
+			if cap(packed) < n {
+				packed = make([]byte, n)
+			}
+			packed = packed[:n]
+			if _, err := io.ReadFull(br, packed); err != nil {
+				return fmt.Errorf("couldn't read PSD image data: %w", err)
+			}
+			if err := unpackBits(packed, row); err != nil {
+				return fmt.Errorf("couldn't decompress PSD row: %w", err)
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PSD compression %d", compression)
+	}
+
+	channels := make([][]byte, used)
+	for c := range channels {
+		plane := make([]byte, 0, min(width*height, psdPlaneChunk))
+		for y := 0; y < height; y++ {
+			if err := readRow(c, y); err != nil {
+				return nil, err
+			}
+			if bytesPerSample == 1 {
+				plane = append(plane, row...)
+				continue
+			}
+			for x := 0; x < width; x++ {
+				plane = append(plane, row[x*bytesPerSample])
+			}
+		}
+		channels[c] = plane
+	}
+	return channels, nil
+}
+
+// readPSDRowCounts czyta długości skompresowanych wierszy. Tablica obejmuje wszystkie
+// kanały, ale zachowujemy tylko używane - resztę przewijamy.
+func readPSDRowCounts(br *bufio.Reader, h psdHeader, used, rowSize int) ([]uint32, error) {
+	height := int(h.Height)
+	// PackBits w najgorszym razie dokłada bajt nagłówka na każde 128 bajtów
+	maxPacked := uint32(rowSize + rowSize/128 + 1)
+	counts := make([]uint32, 0, min(used*height, psdPlaneChunk))
+	for i := 0; i < used*height; i++ {
+		var n uint32
+		if h.Version == 2 {
+			if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+				return nil, fmt.Errorf("couldn't read PSD row lengths: %w", err)
+			}
+		} else {
+			var n16 uint16
+			if err := binary.Read(br, binary.BigEndian, &n16); err != nil {
+				return nil, fmt.Errorf("couldn't read PSD row lengths: %w", err)
+			}
+			n = uint32(n16)
+		}
+		if n > maxPacked {
+			return nil, fmt.Errorf("PSD row length %d exceeds %d", n, maxPacked)
+		}
+		counts = append(counts, n)
+	}
+
+	countSize := int64(2)
+	if h.Version == 2 {
+		countSize = 4
+	}
+	rest := int64(int(h.Channels)-used) * int64(height) * countSize
+	if _, err := io.CopyN(io.Discard, br, rest); err != nil {
+		return nil, fmt.Errorf("couldn't read PSD row lengths: %w", err)
+	}
+	return counts, nil
+}
+
+// unpackBits dekompresuje wiersz zakodowany algorytmem PackBits
+func unpackBits(src, dst []byte) error {
+	i, o := 0, 0
+	for i < len(src) && o < len(dst) {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			count := n + 1
+			if i+count > len(src) || o+count > len(dst) {
+				return fmt.Errorf("literal run out of range")
+			}
+			copy(dst[o:], src[i:i+count])
+			i += count
+			o += count
+		case n != -128:
+			count := 1 - n
+			if i >= len(src) || o+count > len(dst) {
+				return fmt.Errorf("repeat run out of range")
+			}
+			for k := 0; k < count; k++ {
+				dst[o+k] = src[i]
+			}
+			i++
+			o += count
+		}
+	}
+	if o != len(dst) {
+		return fmt.Errorf("row is %d bytes, expected %d", o, len(dst))
+	}
+	return nil
+}
+
+func psdToImage(h psdHeader, channels [][]byte, palette []byte) (image.Image, error) {
+	width, height := int(h.Width), int(h.Height)
+	// Liczbę kanałów sprawdził już psdChannelsUsed
+	sample := func(c, i int) uint8 {
+		return channels[c][i]
+	}
+
+	switch h.ColorMode {
+	case psdModeRGB:
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			a := uint8(255)
+			if len(channels) > 3 {
+				a = sample(3, i)
+			}
+			img.Pix[i*4] = sample(0, i)
+			img.Pix[i*4+1] = sample(1, i)
+			img.Pix[i*4+2] = sample(2, i)
+			img.Pix[i*4+3] = a
+		}
+		return img, nil
+	case psdModeGrayscale:
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			img.Pix[i] = sample(0, i)
+		}
+		return img, nil
+	case psdModeIndexed:
+		if len(palette) != 768 {
+			return nil, fmt.Errorf("invalid PSD palette")
+		}
+		// Paleta PSD jest planarna: 256 wartości R, potem G, potem B
+		pal := make(color.Palette, 256)
+		for i := range pal {
+			pal[i] = color.RGBA{palette[i], palette[256+i], palette[512+i], 255}
+		}
+		img := image.NewPaletted(image.Rect(0, 0, width, height), pal)
+		copy(img.Pix, channels[0])
+		return img, nil
+	case psdModeCMYK:
+		// PSD zapisuje CMYK odwrócone (255 = brak farby)
+		img := image.NewCMYK(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			img.Pix[i*4] = 255 - sample(0, i)
+			img.Pix[i*4+1] = 255 - sample(1, i)
+			img.Pix[i*4+2] = 255 - sample(2, i)
+			img.Pix[i*4+3] = 255 - sample(3, i)
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("unsupported PSD color mode %d", h.ColorMode)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// Pliki RAW (DNG, CR2, NEF) to kontenery TIFF. Zamiast wywoływać surowe dane
+// z matrycy, bierzemy największy osadzony podgląd JPEG - aparaty i Lightroom
+// zapisują go zwykle w pełnej lub prawie pełnej rozdzielczości.
+
+// Ograniczenie zagnieżdżenia SubIFD i liczby odwiedzonych katalogów (ochrona przed pętlami)
+const (
+	maxRAWIFDDepth = 4
+	maxRAWIFDs     = 64
+)
+
+func decodeRAW(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read RAW file: %w", err)
+	}
+	t, first, err := parseTIFF(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse RAW container: %w", err)
+	}
+
+	orientation := 1
+	var previews [][]byte
+	visited := map[uint32]bool{}
+
+	var walk func(offset uint32, depth int)
+	walk = func(offset uint32, depth int) {
+		for offset != 0 && !visited[offset] && len(visited) < maxRAWIFDs {
+			visited[offset] = true
+			entries, next, err := t.readIFD(offset)
+			if err != nil {
+				return
+			}
+			if offset == first {
+				if e, ok := findTag(entries, tagOrientation); ok {
+					if o, err := t.uint(e); err == nil && o >= 1 && o <= 8 {
+						orientation = int(o)
+					}
+				}
+			}
+			previews = append(previews, t.jpegPreviews(entries)...)
+
+			if e, ok := findTag(entries, tagSubIFDs); ok && depth < maxRAWIFDDepth {
+				if subs, err := t.uints(e); err == nil {
+					for _, sub := range subs {
+						walk(sub, depth+1)
+					}
+				}
+			}
+			offset = next
+		}
+	}
+	walk(first, 0)
+
+	// Wybierz największy podgląd, który da się zdekodować jako zwykły JPEG
+	// (odrzuca m.in. bezstratne JPEG z danymi RAW w CR2/DNG)
+	var best []byte
+	bestPixels := 0
+	for _, p := range previews {
+		c, err := jpeg.DecodeConfig(bytes.NewReader(p))
+		if err != nil {
+			continue
+		}
+		if pixels := c.Width * c.Height; pixels > bestPixels {
+			best, bestPixels = p, pixels
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("RAW file has no embedded JPEG preview")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(best))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode RAW preview: %w", err)
+	}
+	return applyOrientation(img, orientation), nil
+}
+
+// jpegPreviews zwraca dane JPEG wskazywane przez katalog - przez
+// JPEGInterchangeFormat albo przez pojedynczy pasek skompresowany JPEG
+func (t *tiffReader) jpegPreviews(entries []tiffEntry) [][]byte {
+	var previews [][]byte
+	slice := func(offset, length uint32) {
+		end := uint64(offset) + uint64(length)
+		if length < 2 || end > uint64(len(t.data)) {
+			return
+		}
+		p := t.data[offset:end]
+		if p[0] == 0xFF && p[1] == 0xD8 {
+			previews = append(previews, p)
+		}
+	}
+
+	offE, ok1 := findTag(entries, tagJPEGOffset)
+	lenE, ok2 := findTag(entries, tagJPEGLength)
+	if ok1 && ok2 {
+		offset, err1 := t.uint(offE)
+		length, err2 := t.uint(lenE)
+		if err1 == nil && err2 == nil {
+			slice(offset, length)
+		}
+	}
+
+	compE, ok := findTag(entries, tagCompression)
+	if !ok {
+		return previews
+	}
+	compression, err := t.uint(compE)
+	if err != nil || (compression != 6 && compression != 7) {
+		return previews
+	}
+	stripE, ok1 := findTag(entries, tagStripOffsets)
+	countE, ok2 := findTag(entries, tagStripByteCounts)
+	if !ok1 || !ok2 {
+		return previews
+	}
+	offsets, err1 := t.uints(stripE)
+	counts, err2 := t.uints(countE)
+	if err1 == nil && err2 == nil && len(offsets) == 1 && len(counts) == 1 {
+		slice(offsets[0], counts[0])
+	}
+	return previews
+}
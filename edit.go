@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+)
+
+// imageEdit to pojedyncza operacja użytkownika na obrazie w poczekalni.
+// Kadr jest zapisany ułamkami (0-1) wymiarów obrazu z podglądu po poprzednich
+// edycjach, więc nie zależy od rozdzielczości podglądu ani oryginału. Potok nakłada
+// edycje po swoich krokach orient/crop (zob. compiledPipeline.editsAt), żeby
+// współrzędne trafiały w ten sam fragment, który użytkownik widział.
+// Kąt obrotu jest liczony zgodnie z ruchem wskazówek zegara.
+type imageEdit struct {
+	Op     string  `json:"op"`
+	Angle  int     `json:"angle,omitempty"`
+	Axis   string  `json:"axis,omitempty"`
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+}
+
+const (
+	editRotate = "rotate"
+	editFlip   = "flip"
+	editCrop   = "crop"
+)
+
+// Najmniejszy kadr (ułamek boku) - chroni przed obrazem zerowej szerokości
+const minCropFraction = 0.01
+
+// Każda edycja odtwarza całą listę od oryginału, więc jej długość jest ograniczona
+const maxEdits = 20
+
+// normalizeEdit sprawdza operację i sprowadza ją do postaci kanonicznej
+// (kąt 0/90/180/270, kadr obcięty do granic obrazu). Zwraca false dla operacji bez efektu.
+func normalizeEdit(e imageEdit) (imageEdit, bool, error) {
+	switch e.Op {
+	case editRotate:
+		if e.Angle%90 != 0 {
+			return imageEdit{}, false, fmt.Errorf("rotate angle must be a multiple of 90")
+		}
+		angle := ((e.Angle % 360) + 360) % 360
+		return imageEdit{Op: editRotate, Angle: angle}, angle != 0, nil
+	case editFlip:
+		if e.Axis != "horizontal" && e.Axis != "vertical" {
+			return imageEdit{}, false, fmt.Errorf("flip axis must be 'horizontal' or 'vertical'")
+		}
+		return imageEdit{Op: editFlip, Axis: e.Axis}, true, nil
+	case editCrop:
+		for _, v := range []float64{e.X, e.Y, e.Width, e.Height} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return imageEdit{}, false, fmt.Errorf("crop values must be finite")
+			}
+		}
+		if e.X < 0 || e.Y < 0 || e.X >= 1 || e.Y >= 1 {
+			return imageEdit{}, false, fmt.Errorf("crop origin must be within the image (0-1)")
+		}
+		w := math.Min(e.Width, 1-e.X)
+		h := math.Min(e.Height, 1-e.Y)
+		if w < minCropFraction || h < minCropFraction {
+			return imageEdit{}, false, fmt.Errorf("crop area is too small")
+		}
+		full := e.X == 0 && e.Y == 0 && w == 1 && h == 1
+		return imageEdit{Op: editCrop, X: e.X, Y: e.Y, Width: w, Height: h}, !full, nil
+	}
+	return imageEdit{}, false, fmt.Errorf("unknown edit operation '%s'", e.Op)
+}
+
+// appendEdit dopisuje operację do listy. Obroty i odbicia następujące po sobie
+// sklejane są w najwyżej dwie operacje: odbicie poziome i obrót.
+func appendEdit(edits []imageEdit, e imageEdit) []imageEdit {
+	if e.Op != editRotate && e.Op != editFlip {
+		return append(edits, e)
+	}
+	start := len(edits)
+	for start > 0 && (edits[start-1].Op == editRotate || edits[start-1].Op == editFlip) {
+		start--
+	}
+
+	// Stan to obrót o angle po ewentualnym odbiciu poziomym. Odbicie po obrocie
+	// odwraca jego kierunek, a odbicie pionowe to poziome plus obrót o 180°.
+	flipped, angle := false, 0
+	for _, op := range append(edits[start:len(edits):len(edits)], e) {
+		switch {
+		case op.Op == editRotate:
+			angle += op.Angle
+		case op.Axis == "horizontal":
+			flipped, angle = !flipped, -angle
+		default:
+			flipped, angle = !flipped, 180-angle
+		}
+	}
+	angle = ((angle % 360) + 360) % 360
+
+	edits = edits[:start]
+	if flipped {
+		edits = append(edits, imageEdit{Op: editFlip, Axis: "horizontal"})
+	}
+	if angle != 0 {
+		edits = append(edits, imageEdit{Op: editRotate, Angle: angle})
+	}
+	return edits
+}
+
+func parseEdits(data string) ([]imageEdit, error) {
+	var edits []imageEdit
+	if data == "" {
+		return edits, nil
+	}
+	if err := json.Unmarshal([]byte(data), &edits); err != nil {
+		return nil, fmt.Errorf("couldn't parse edits: %w", err)
+	}
+	return edits, nil
+}
+
+// applyEdits nakłada zapisane edycje po kolei
+func applyEdits(img image.Image, edits []imageEdit) image.Image {
+	for _, e := range edits {
+		switch e.Op {
+		case editRotate:
+			switch e.Angle {
+			case 90:
+				img = rotate90(img)
+			case 180:
+				img = rotate180(img)
+			case 270:
+				img = rotate270(img)
+			}
+		case editFlip:
+			if e.Axis == "horizontal" {
+				img = flipHorizontal(img)
+			} else {
+				img = flipVertical(img)
+			}
+		case editCrop:
+			b := img.Bounds()
+			x0 := int(math.Round(e.X * float64(b.Dx())))
+			y0 := int(math.Round(e.Y * float64(b.Dy())))
+			x1 := int(math.Round((e.X + e.Width) * float64(b.Dx())))
+			y1 := int(math.Round((e.Y + e.Height) * float64(b.Dy())))
+			x1 = max(x1, x0+1)
+			y1 = max(y1, y0+1)
+			img = cropRect(img, image.Rect(x0, y0, x1, y1))
+		}
+	}
+	return img
+}
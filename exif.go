@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jdeng/goheif"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// readExif zwraca surowe dane TIFF z bloku EXIF (JPEG lub HEIC).
+// Po odczycie źródło jest przewijane na początek.
+func readExif(r io.ReadSeeker, mediaType string) ([]byte, error) {
+	defer r.Seek(0, io.SeekStart)
+
+	switch mediaType {
+	case "image/jpeg", "image/jpg":
+		return readJPEGExif(r)
+	case "image/heic", "image/heif":
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read source: %w", err)
+			}
+			ra = bytes.NewReader(data)
+		}
+		data, err := goheif.ExtractExif(ra)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't extract HEIC exif: %w", err)
+		}
+		return trimExifHeader(data)
+	}
+	return nil, fmt.Errorf("exif not supported for %s", mediaType)
+}
+
+// readJPEGExif przechodzi po segmentach JPEG aż do segmentu APP1 z EXIF
+func readJPEGExif(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, fmt.Errorf("not a jpeg file")
+	}
+
+	for {
+		marker, err := nextJPEGMarker(br)
+		if err != nil {
+			return nil, err
+		}
+		// SOS / EOI - dalej są już dane obrazu
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, fmt.Errorf("no exif segment")
+		}
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			return nil, fmt.Errorf("couldn't read jpeg segment: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return nil, fmt.Errorf("invalid jpeg segment length")
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, fmt.Errorf("couldn't read jpeg segment: %w", err)
+		}
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):], nil
+		}
+	}
+}
+
+func nextJPEGMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read jpeg marker: %w", err)
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("invalid jpeg marker")
+	}
+	// Markery mogą być poprzedzone dowolną liczbą bajtów 0xFF
+	for b == 0xFF {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, fmt.Errorf("couldn't read jpeg marker: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// trimExifHeader usuwa prefiks "Exif\0\0" lub inne bajty przed nagłówkiem TIFF
+func trimExifHeader(data []byte) ([]byte, error) {
+	if i := bytes.Index(data, exifHeader); i >= 0 {
+		return data[i+len(exifHeader):], nil
+	}
+	for _, magic := range [][]byte{[]byte("II*\x00"), []byte("MM\x00*")} {
+		if i := bytes.Index(data, magic); i >= 0 {
+			return data[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("no tiff header in exif block")
+}
+
+// exifOrientation zwraca orientację z EXIF (1-8). Brak danych oznacza 1.
+func exifOrientation(r io.ReadSeeker, mediaType string) int {
+	data, err := readExif(r, mediaType)
+	if err != nil {
+		return 1
+	}
+	t, offset, err := parseTIFF(data)
+	if err != nil {
+		return 1
+	}
+	entries, _, err := t.readIFD(offset)
+	if err != nil {
+		return 1
+	}
+	e, ok := findTag(entries, tagOrientation)
+	if !ok {
+		return 1
+	}
+	orientation, err := t.uint(e)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return int(orientation)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Szablon nazwy publikowanego pliku, np. "{site}-{slug}-{width}".
+// Dostępne pola: {site}, {slug}, {width}, {height}, {preset}.
+const defaultFilenameTemplate = "{slug}"
+
+const maxSlugLength = 80
+
+var filenamePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+var filenameFieldNames = map[string]bool{
+	"{site}":   true,
+	"{slug}":   true,
+	"{width}":  true,
+	"{height}": true,
+	"{preset}": true,
+}
+
+// Litery, które nie rozkładają się w NFD na literę łacińską i znak diakrytyczny
+var letterTransliteration = map[rune]string{
+	'ł': "l", 'ø': "o", 'đ': "d", 'ð': "d", 'ħ': "h", 'ı': "i", 'ŧ': "t",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th",
+}
+
+type filenameFields struct {
+	Site   string
+	Slug   string
+	Width  int
+	Height int
+	Preset string
+}
+
+// validateFilenameTemplate sprawdza szablon przy starcie, żeby literówka nie wyszła dopiero przy uploadzie
+func validateFilenameTemplate(template string) error {
+	if !strings.Contains(template, "{slug}") {
+		return fmt.Errorf("template must contain {slug}")
+	}
+	for _, field := range filenamePlaceholder.FindAllString(template, -1) {
+		if !filenameFieldNames[field] {
+			return fmt.Errorf("unknown field %s", field)
+		}
+	}
+	return nil
+}
+
+// slugify zamienia tekst na małe litery, cyfry i myślniki. Litery z diakrytykami
+// są transliterowane przez rozkład NFD i usunięcie znaków łączących (é -> e, ř -> r).
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if t, ok := letterTransliteration[r]; ok {
+			b.WriteString(t)
+			dash = false
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-")
+}
+
+// renderFilename buduje nazwę pliku (bez rozszerzenia) z szablonu.
+// Skracany jest tylko slug, żeby nie obciąć pól z końca szablonu ({width}, {preset}).
+func renderFilename(template string, f filenameFields) string {
+	slug := slugify(f.Slug)
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	if slug == "" {
+		slug = "image"
+	}
+	name := strings.NewReplacer(
+		"{site}", f.Site,
+		"{slug}", slug,
+		"{width}", strconv.Itoa(f.Width),
+		"{height}", strconv.Itoa(f.Height),
+		"{preset}", f.Preset,
+	).Replace(template)
+	// Puste pola (np. brak {site}) nie zostawiają podwójnych myślników
+	return slugify(name)
+}
+
+// slugSource zwraca tekst, z którego powstaje nazwa: tytuł albo nazwa oryginału bez rozszerzenia
+func slugSource(title, originalName string) string {
+	if strings.TrimSpace(title) != "" {
+		return title
+	}
+	base := filepath.Base(originalName)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// filenameReservations pilnuje, żeby równoległe workery nie wybrały tej samej nazwy,
+// zanim pierwsza z nich trafi do rejestru staged_assets
+type filenameReservations struct {
+	mu       sync.Mutex
+	reserved map[string]bool
+}
+
+func newFilenameReservations() *filenameReservations {
+	return &filenameReservations{reserved: map[string]bool{}}
+}
+
+// reserveFilename zwraca wolną nazwę base.webp, base-2.webp, ... i ją rezerwuje.
+// Kolejny numer pochodzi z jednego zapytania o najwyższy zajęty sufiks, więc
+// popularne nazwy (image, collage) nie wymagają sprawdzania kandydatów po kolei.
+// Rezerwację trzeba zwolnić przez releaseFilename po zapisaniu wpisu w rejestrze.
+func (cfg *apiConfig) reserveFilename(ctx context.Context, base string) (string, error) {
+	cfg.filenames.mu.Lock()
+	defer cfg.filenames.mu.Unlock()
+
+	taken, err := cfg.db.GetMaxFilenameSuffix(ctx, base)
+	if err != nil {
+		return "", fmt.Errorf("couldn't check filename: %w", err)
+	}
+	// Rezerwacje innych workerów nie są jeszcze w rejestrze - pomijamy je w pamięci
+	for n := int(taken) + 1; ; n++ {
+		name := base + ".webp"
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d.webp", base, n)
+		}
+		if cfg.filenames.reserved[name] {
+			continue
+		}
+		cfg.filenames.reserved[name] = true
+		return name, nil
+	}
+}
+
+func (cfg *apiConfig) releaseFilename(name string) {
+	cfg.filenames.mu.Lock()
+	defer cfg.filenames.mu.Unlock()
+	delete(cfg.filenames.reserved, name)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Zażółć gęślą jaźń", "zazolc-gesla-jazn"},
+		{"Łódź", "lodz"},
+		{"Straße", "strasse"},
+		{"Ærø Øresund", "aero-oresund"},
+		{"Dvořák café", "dvorak-cafe"},
+		{"  IMG_1234 (kopia)  ", "img-1234-kopia"},
+		{"a -- b", "a-b"},
+		{"日本", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.in); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderFilename(t *testing.T) {
+	long := strings.Repeat("abcd-", 30)
+	tests := []struct {
+		name     string
+		template string
+		fields   filenameFields
+		want     string
+	}{
+		{"default", defaultFilenameTemplate, filenameFields{Slug: "Wakacje 2024"}, "wakacje-2024"},
+		{"all fields", "{site}-{slug}-{width}x{height}-{preset}", filenameFields{Site: "Blog", Slug: "Kraków", Width: 1200, Height: 800, Preset: "hero"}, "blog-krakow-1200x800-hero"},
+		{"empty site", "{site}-{slug}", filenameFields{Slug: "kot"}, "kot"},
+		{"empty slug", "{slug}-{width}", filenameFields{Slug: "?!", Width: 640}, "image-640"},
+		{"truncated slug", "{slug}-{width}", filenameFields{Slug: long, Width: 640}, strings.TrimRight(long[:maxSlugLength], "-") + "-640"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderFilename(tt.template, tt.fields); got != tt.want {
+				t.Errorf("renderFilename(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFilenameTruncatesOnlySlug(t *testing.T) {
+	got := renderFilename("{slug}-{preset}", filenameFields{Slug: strings.Repeat("x", 200), Preset: "thumb"})
+	if want := strings.Repeat("x", maxSlugLength) + "-thumb"; got != want {
+		t.Errorf("got %q (%d chars), want %q", got, len(got), want)
+	}
+}
+
+func TestValidateFilenameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		ok       bool
+	}{
+		{defaultFilenameTemplate, true},
+		{"{site}-{slug}-{width}x{height}-{preset}", true},
+		{"{site}-{width}", false},
+		{"photo", false},
+		{"{slug}-{date}", false},
+		{"{slug}-{Width}", false},
+	}
+	for _, tt := range tests {
+		err := validateFilenameTemplate(tt.template)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateFilenameTemplate(%q) = %v, want ok=%v", tt.template, err, tt.ok)
+		}
+	}
+}
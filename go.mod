@@ -7,6 +7,7 @@ require (
 	github.com/adrium/goheif v0.0.0-20230113233934-ca402e77a786 // indirect
 	github.com/alexedwards/argon2id v1.0.0 // indirect
 	github.com/chai2010/webp v1.4.0 // indirect
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
 	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/jdeng/goheif v0.0.0-20251001174315-babb64285736 // indirect
@@ -21,4 +22,5 @@ require (
 	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
 )
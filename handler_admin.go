@@ -11,6 +11,8 @@ import (
 	"github.com/Pepegakac123/goCmsAssistant/internal/database"
 )
 
+var validRoles = map[string]bool{"admin": true, "user": true}
+
 type User struct {
 	ID           int    `json:"id"`
 	Name         string `json:"name"`
@@ -51,7 +53,6 @@ func (cfg *apiConfig) registerUserHandler(w http.ResponseWriter, r *http.Request
 	}
 	p.Password = hashPwd
 
-	validRoles := map[string]bool{"admin": true, "user": true}
 	if !validRoles[p.Role] {
 		respondWithError(w, http.StatusBadRequest, "Invalid role", nil)
 		return
@@ -180,3 +181,32 @@ func (cfg *apiConfig) createDefaultUser(ctx context.Context) (User, error) {
 		RefreshToken: refreshToken,
 	}, nil
 }
+
+// stagingJanitorHandler pokazuje ostatnie uruchomienie janitora i bieżące zajęcie poczekalni
+func (cfg *apiConfig) stagingJanitorHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := cfg.db.GetStagingUsage(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get staging usage", err)
+		return
+	}
+	lastRun, totals := cfg.janitor.snapshot()
+
+	type stagingUsage struct {
+		Files         int64 `json:"files"`
+		WebpBytes     int64 `json:"webpBytes"`
+		OriginalBytes int64 `json:"originalBytes"`
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"enabled":        cfg.janitor.ttl > 0 || cfg.janitor.trashRetention > 0,
+		"ttl":            cfg.janitor.ttl.String(),
+		"trashRetention": cfg.janitor.trashRetention.String(),
+		"interval":       stagingJanitorInterval.String(),
+		"lastRun":        lastRun,
+		"totals":         totals,
+		"staging": stagingUsage{
+			Files:         usage.Files,
+			WebpBytes:     usage.WebpBytes,
+			OriginalBytes: usage.OriginalBytes,
+		},
+	})
+}
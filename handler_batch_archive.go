@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Pobieranie opublikowanych plików z WordPressa nie może wisieć w nieskończoność
+const archiveFetchTimeout = 2 * time.Minute
+
+// batchArchiveHandler strumieniuje ZIP z plikami partii bez składania go na dysku.
+// Partia w poczekalni daje pliki lokalne (i opcjonalnie oryginały),
+// opublikowana - pliki pobierane z WordPressa według historii wysyłek
+// (i opcjonalnie oryginały z magazynu adresowanego treścią).
+func (cfg *apiConfig) batchArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	batchID := r.PathValue("id")
+	if _, err := uuid.Parse(batchID); err != nil {
+		respondWithError(w, http.StatusNotFound, "Batch not found", err)
+		return
+	}
+	includeOriginals, _ := strconv.ParseBool(r.URL.Query().Get("originals"))
+
+	var write func(zw *zip.Writer) error
+	if err := cfg.openBatch(r.Context(), userID, batchID); err == nil {
+		assets, err := cfg.db.ListStagedAssetsByBatch(r.Context(), database.ListStagedAssetsByBatchParams{
+			UserID:  int64(userID),
+			BatchID: batchID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list batch", err)
+			return
+		}
+		write = func(zw *zip.Writer) error {
+			return writeStagedArchive(r.Context(), zw, cfg.staging, assets, includeOriginals)
+		}
+	} else {
+		rows, err := cfg.db.GetPublishedBatch(r.Context(), database.GetPublishedBatchParams{
+			UserID:  int64(userID),
+			BatchID: &batchID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get upload history", err)
+			return
+		}
+		if len(rows) == 0 {
+			respondWithError(w, http.StatusNotFound, "Batch not found", nil)
+			return
+		}
+		write = func(zw *zip.Writer) error {
+			return cfg.writePublishedArchive(r.Context(), zw, rows, includeOriginals)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="batch-%s.zip"`, batchID))
+	w.WriteHeader(http.StatusOK)
+
+	// Nagłówki już poszły - przy błędzie zostaje tylko przerwać strumień i zalogować
+	zw := zip.NewWriter(w)
+	if err := write(zw); err != nil {
+		log.Printf("Couldn't stream archive of batch %s: %v", batchID, err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Couldn't finish archive of batch %s: %v", batchID, err)
+	}
+}
+
+func writeStagedArchive(ctx context.Context, zw *zip.Writer, store storage.Storage, assets []database.StagedAsset, includeOriginals bool) error {
+	names := zipNames{}
+	for _, asset := range assets {
+		key := stagingKey(int(asset.UserID), asset.BatchID, asset.Filename)
+		if err := addObjectToZip(ctx, zw, store, names.unique(asset.Filename), key); err != nil {
+			return err
+		}
+		if includeOriginals && asset.OriginalFile != "" {
+			name := path.Join(originalsDirName, path.Base(asset.OriginalFile))
+			key := stagingKey(int(asset.UserID), asset.BatchID, asset.OriginalFile)
+			if err := addObjectToZip(ctx, zw, store, names.unique(name), key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) writePublishedArchive(ctx context.Context, zw *zip.Writer, rows []database.UploadHistory, includeOriginals bool) error {
+	client := &http.Client{Timeout: archiveFetchTimeout}
+	// Oryginały mogły zostać zapisane, zanim wyłączono ich przechowywanie
+	originals := cfg.originals
+	if originals == nil {
+		originals = newOriginalStore(cfg.assets)
+	}
+	names := zipNames{}
+	for _, row := range rows {
+		if row.WordpressUrl == nil {
+			continue
+		}
+		if err := addURLToZip(ctx, client, zw, names.unique(row.Filename), *row.WordpressUrl); err != nil {
+			return err
+		}
+		if !includeOriginals || row.OriginalHash == nil {
+			continue
+		}
+		if err := cfg.addPublishedOriginalToZip(ctx, zw, originals, names, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPublishedOriginalToZip dodaje oryginał opublikowanego pliku pod nazwą pliku WebP
+// z rozszerzeniem oryginału. Oryginał usunięty w międzyczasie przez purge jest pomijany.
+func (cfg *apiConfig) addPublishedOriginalToZip(ctx context.Context, zw *zip.Writer, originals *originalStore, names zipNames, row database.UploadHistory) error {
+	hash := *row.OriginalHash
+	original, err := cfg.db.GetOriginal(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("couldn't get original of %s: %w", row.Filename, err)
+	}
+	name := path.Join(originalsDirName, strings.TrimSuffix(row.Filename, ".webp")+mediaTypeExtension(original.MediaType))
+	err = addObjectToZip(ctx, zw, originals.store, names.unique(name), originals.key(hash))
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Original %s of %s is missing from storage", hash, row.Filename)
+		return nil
+	}
+	return err
+}
+
+// zipNames pilnuje unikalności nazw wpisów archiwum (bez względu na wielkość liter,
+// żeby rozpakowanie na Windowsie/macOS niczego nie nadpisało). Powtórzona nazwa
+// dostaje przyrostek przed rozszerzeniem: zdjecie.webp, zdjecie-2.webp, ...
+type zipNames map[string]bool
+
+func (n zipNames) unique(name string) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; n[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	n[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// WebP jest już skompresowany, więc wpisy zapisujemy bez deflate (Store)
+func createZipEntry(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+}
+
+func addObjectToZip(ctx context.Context, zw *zip.Writer, store storage.Storage, name, key string) error {
+	file, info, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	entry, err := createZipEntry(zw, name, info.ModTime)
+	if err != nil {
+		return fmt.Errorf("couldn't add %s to archive: %w", name, err)
+	}
+	if _, err := io.Copy(entry, file); err != nil {
+		return fmt.Errorf("couldn't write %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+func addURLToZip(ctx context.Context, client *http.Client, zw *zip.Writer, name, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't create request for %s: %w", name, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't fetch %s: unexpected status code %d", name, resp.StatusCode)
+	}
+
+	entry, err := createZipEntry(zw, name, time.Now())
+	if err != nil {
+		return fmt.Errorf("couldn't add %s to archive: %w", name, err)
+	}
+	if _, err := io.Copy(entry, resp.Body); err != nil {
+		return fmt.Errorf("couldn't write %s to archive: %w", name, err)
+	}
+	return nil
+}
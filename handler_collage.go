@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/chai2010/webp"
+	"github.com/nfnt/resize"
+)
+
+// Kolaż składa pliki z poczekalni w siatkę i zapisuje wynik jako nowy plik
+// poczekalni - tą samą ścieżką kodowania co upload (preset, autoQuality, SSIM).
+// Źródłem są pliki WebP z poczekalni, czyli obrazy już po edycjach.
+
+const (
+	maxCollageCells     = 64
+	maxCollageSide      = 8000
+	defaultCollageWidth = 2048
+	defaultCollageName  = "collage"
+)
+
+type collageLayout struct {
+	Columns    int    `json:"columns"`
+	Rows       int    `json:"rows"`
+	Gutter     int    `json:"gutter"`
+	Background string `json:"background"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	// cover przycina obraz do komórki, contain mieści go w całości na tle
+	Fit     string `json:"fit"`
+	Gravity string `json:"gravity"`
+}
+
+// collageHandler tworzy kolaż z podanych plików użytkownika. Pliki wypełniają
+// komórki wierszami; niewypełnione komórki zostają w kolorze tła.
+func (cfg *apiConfig) collageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	type parameters struct {
+		Filenames []string `json:"filenames"`
+		collageLayout
+		uploadSettings
+		Batch string `json:"batch"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	if len(p.Filenames) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No filenames provided", nil)
+		return
+	}
+	layout, background, err := normalizeCollageLayout(p.collageLayout, len(p.Filenames))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	preset, pipeline, err := cfg.resolvePipeline(r.Context(), p.Preset, p.Destination, p.AutoQuality)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	// Najpierw sprawdzamy wszystkie pliki, żeby nie dekodować połowy listy na próżno
+	keys := make([]string, len(p.Filenames))
+	for i, filename := range p.Filenames {
+		_, key, err := cfg.findStagedAsset(r.Context(), userID, filename)
+		if err != nil {
+			if errors.Is(err, errStagedFileNotFound) {
+				err = fmt.Errorf("file '%s' not found", filename)
+				respondWithError(w, http.StatusNotFound, err.Error(), err)
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't get staged image", err)
+			}
+			return
+		}
+		keys[i] = key
+	}
+
+	// Płótno do 8000×8000 i kodowanie z pomiarem SSIM są kosztowne - liczba
+	// kolaży składanych naraz jest ograniczona tak jak workery uploadu
+	release, err := cfg.acquireCollageSlot(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Request cancelled while waiting for a free worker", err)
+		return
+	}
+	workPath := cfg.scratchPath()
+	defer os.Remove(workPath)
+	webpSize, metrics, err := cfg.composeAndEncodeCollage(r.Context(), keys, layout, background, workPath, pipeline.encode)
+	release()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create collage", err)
+		return
+	}
+	// Rozmiar wyniku znamy dopiero po kodowaniu, więc limit sprawdzamy tutaj
+	if !cfg.enforceQuota(w, r, userID, 1, webpSize) {
+		return
+	}
+
+	batchID, ok := cfg.resolveBatchOrRespond(w, r, userID, p.Batch)
+	if !ok {
+		return
+	}
+
+	title := truncateRunes(strings.TrimSpace(p.Title), maxTitleLength)
+	base := renderFilename(cfg.filenameTemplate, filenameFields{
+		Site:   p.Destination,
+		Slug:   slugSource(title, defaultCollageName),
+		Width:  layout.Width,
+		Height: layout.Height,
+		Preset: preset.Name,
+	})
+	filename, err := cfg.reserveFilename(r.Context(), base)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reserve filename", err)
+		return
+	}
+	defer cfg.releaseFilename(filename)
+
+	outputKey := stagingKey(userID, batchID, filename)
+	if err := cfg.putStagedFile(r.Context(), outputKey, workPath); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store collage", err)
+		return
+	}
+	asset, err := cfg.db.CreateStagedAsset(r.Context(), database.CreateStagedAssetParams{
+		Filename:     filename,
+		BatchID:      batchID,
+		UserID:       int64(userID),
+		OriginalName: defaultCollageName + ".webp",
+		WebpSize:     webpSize,
+		Width:        int64(layout.Width),
+		Height:       int64(layout.Height),
+		Preset:       preset.Name,
+		Title:        title,
+		Ssim:         metrics.SSIM,
+		Quality:      float64(metrics.Quality),
+		MediaType:    "image/webp",
+		Destination:  p.Destination,
+		AutoQuality:  boolToInt64(p.AutoQuality),
+		Keywords:     encodeKeywords(nil),
+	})
+	if err != nil {
+		cfg.staging.Delete(r.Context(), outputKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record staged image", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, cfg.stagedImage(r.Context(), asset))
+}
+
+// normalizeCollageLayout uzupełnia wartości domyślne i sprawdza, czy komórki się mieszczą.
+// Bez podanej siatki liczba kolumn jest najbliższa kwadratowi, a bez wysokości
+// komórki wychodzą kwadratowe.
+func normalizeCollageLayout(layout collageLayout, images int) (collageLayout, color.NRGBA, error) {
+	if layout.Columns < 0 || layout.Rows < 0 || layout.Gutter < 0 || layout.Width < 0 || layout.Height < 0 {
+		return layout, color.NRGBA{}, fmt.Errorf("layout values must not be negative")
+	}
+	// Ograniczenia przed jakimikolwiek obliczeniami - inaczej mnożenie mogłoby się przepełnić
+	if layout.Gutter > maxCollageSide || layout.Width > maxCollageSide || layout.Height > maxCollageSide {
+		return layout, color.NRGBA{}, fmt.Errorf("gutter and output size must not exceed %d", maxCollageSide)
+	}
+	if layout.Columns > maxCollageCells || layout.Rows > maxCollageCells {
+		return layout, color.NRGBA{}, fmt.Errorf("grid is larger than %d cells", maxCollageCells)
+	}
+	if layout.Columns == 0 {
+		layout.Columns = int(math.Ceil(math.Sqrt(float64(images))))
+	}
+	if layout.Rows == 0 {
+		layout.Rows = (images + layout.Columns - 1) / layout.Columns
+	}
+	if layout.Columns*layout.Rows > maxCollageCells {
+		return layout, color.NRGBA{}, fmt.Errorf("grid has %d cells, limit is %d", layout.Columns*layout.Rows, maxCollageCells)
+	}
+	if images > layout.Columns*layout.Rows {
+		return layout, color.NRGBA{}, fmt.Errorf("%d images don't fit in a %dx%d grid", images, layout.Columns, layout.Rows)
+	}
+
+	if layout.Width == 0 {
+		layout.Width = defaultCollageWidth
+	}
+	if layout.Height == 0 {
+		cell := (layout.Width - layout.Gutter*(layout.Columns+1)) / layout.Columns
+		layout.Height = cell*layout.Rows + layout.Gutter*(layout.Rows+1)
+	}
+	if layout.Width > maxCollageSide || layout.Height > maxCollageSide {
+		return layout, color.NRGBA{}, fmt.Errorf("output is larger than %dx%d", maxCollageSide, maxCollageSide)
+	}
+	if layout.Width-layout.Gutter*(layout.Columns+1) < layout.Columns ||
+		layout.Height-layout.Gutter*(layout.Rows+1) < layout.Rows {
+		return layout, color.NRGBA{}, fmt.Errorf("gutter %d leaves no room for cells", layout.Gutter)
+	}
+
+	if layout.Fit == "" {
+		layout.Fit = "cover"
+	}
+	if layout.Fit != "cover" && layout.Fit != "contain" {
+		return layout, color.NRGBA{}, fmt.Errorf("invalid fit '%s'", layout.Fit)
+	}
+	if layout.Gravity == "" {
+		layout.Gravity = "center"
+	}
+	switch layout.Gravity {
+	case "center", "top", "bottom", "left", "right":
+	default:
+		return layout, color.NRGBA{}, fmt.Errorf("invalid gravity '%s'", layout.Gravity)
+	}
+
+	if layout.Background == "" {
+		layout.Background = "#ffffff"
+	}
+	background, err := parseHexColor(layout.Background)
+	if err != nil {
+		return layout, color.NRGBA{}, err
+	}
+	return layout, background, nil
+}
+
+// acquireCollageSlot czeka na wolne miejsce wśród numWorkers równoczesnych kolaży.
+// Zwrócona funkcja zwalnia miejsce.
+func (cfg *apiConfig) acquireCollageSlot(ctx context.Context) (func(), error) {
+	select {
+	case cfg.collageSlots <- struct{}{}:
+		return func() { <-cfg.collageSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// composeAndEncodeCollage składa kolaż i koduje go do workPath. Płótno nie wychodzi
+// poza tę funkcję, więc pamięć można odzyskać zaraz po zwolnieniu miejsca.
+func (cfg *apiConfig) composeAndEncodeCollage(ctx context.Context, keys []string, layout collageLayout, background color.NRGBA, workPath string, params encodeParams) (int64, cacheMeta, error) {
+	img, err := cfg.composeCollage(ctx, keys, layout, background)
+	if err != nil {
+		return 0, cacheMeta{}, fmt.Errorf("couldn't compose collage: %w", err)
+	}
+	return cfg.encodeWithMetrics(img, workPath, params)
+}
+
+// composeCollage dekoduje pliki po kolei i od razu rysuje je na płótnie,
+// więc w pamięci jest naraz tylko jeden obraz źródłowy
+func (cfg *apiConfig) composeCollage(ctx context.Context, keys []string, layout collageLayout, background color.NRGBA) (*image.NRGBA, error) {
+	canvas := image.NewNRGBA(image.Rect(0, 0, layout.Width, layout.Height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	for i, key := range keys {
+		img, err := cfg.decodeStagedWebP(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		cell := collageCell(layout, i)
+		fitted := fitToCell(img, cell.Dx(), cell.Dy(), layout.Fit, layout.Gravity)
+		// Przy contain obraz jest mniejszy od komórki - wyśrodkowujemy go
+		offset := image.Pt((cell.Dx()-fitted.Bounds().Dx())/2, (cell.Dy()-fitted.Bounds().Dy())/2)
+		target := image.Rectangle{Min: cell.Min.Add(offset), Max: cell.Min.Add(offset).Add(fitted.Bounds().Size())}
+		draw.Draw(canvas, target, fitted, fitted.Bounds().Min, draw.Over)
+	}
+	return canvas, nil
+}
+
+// collageCell zwraca prostokąt i-tej komórki. Reszta z dzielenia szerokości
+// trafia do ostatniej kolumny (wiersza), żeby siatka kończyła się równo z marginesem.
+func collageCell(layout collageLayout, i int) image.Rectangle {
+	col, row := i%layout.Columns, i/layout.Columns
+	cellW := (layout.Width - layout.Gutter*(layout.Columns+1)) / layout.Columns
+	cellH := (layout.Height - layout.Gutter*(layout.Rows+1)) / layout.Rows
+	x := layout.Gutter + col*(cellW+layout.Gutter)
+	y := layout.Gutter + row*(cellH+layout.Gutter)
+	w, h := cellW, cellH
+	if col == layout.Columns-1 {
+		w = layout.Width - layout.Gutter - x
+	}
+	if row == layout.Rows-1 {
+		h = layout.Height - layout.Gutter - y
+	}
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// fitToCell dopasowuje obraz do komórki według trybu fit
+func fitToCell(img image.Image, width, height int, fit, gravity string) image.Image {
+	if fit == "contain" {
+		return resize.Thumbnail(uint(width), uint(height), img, resize.Lanczos3)
+	}
+	cropped := cropToAspect(img, float64(width)/float64(height), gravity)
+	return resize.Resize(uint(width), uint(height), cropped, resize.Lanczos3)
+}
+
+func (cfg *apiConfig) decodeStagedWebP(ctx context.Context, key string) (image.Image, error) {
+	rc, _, err := cfg.staging.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open %s: %w", key, err)
+	}
+	defer rc.Close()
+	img, err := webp.Decode(rc)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode %s: %w", key, err)
+	}
+	return img, nil
+}
+
+// parseHexColor czyta kolor w zapisie "#rgb", "#rrggbb" albo "#rrggbbaa"
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if ok && len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if ok && len(hex) == 6 {
+		hex += "ff"
+	}
+	if !ok || len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s', expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s', expected #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Kolekcja to nazwana grupa plików z poczekalni użytkownika, niezależna od partii.
+// Plik usunięty z poczekalni znika z kolekcji, a plik w koszu jest w niej ukryty
+// do czasu przywrócenia.
+
+const (
+	maxCollectionNameLength        = 100
+	maxCollectionDescriptionLength = 2000
+)
+
+type CollectionResponse struct {
+	ID          int64         `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	ItemCount   int64         `json:"itemCount"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt"`
+	Images      []StagedImage `json:"images,omitempty"`
+}
+
+func collectionResponse(c database.Collection) CollectionResponse {
+	return CollectionResponse{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+}
+
+func (cfg *apiConfig) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	rows, err := cfg.db.ListCollectionsByUser(r.Context(), int64(userID))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list collections", err)
+		return
+	}
+	collections := make([]CollectionResponse, 0, len(rows))
+	for _, row := range rows {
+		collections = append(collections, CollectionResponse{
+			ID:          row.ID,
+			Name:        row.Name,
+			Description: row.Description,
+			ItemCount:   row.ItemCount,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"collections": collections,
+	})
+}
+
+// decodeCollectionParams czyta nazwę i opis kolekcji. Przy błędzie sam odpowiada klientowi.
+func decodeCollectionParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	type parameters struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return "", "", false
+	}
+	name := strings.TrimSpace(p.Name)
+	description := strings.TrimSpace(p.Description)
+	var err error
+	switch {
+	case name == "":
+		err = errors.New("name is required")
+	case utf8.RuneCountInString(name) > maxCollectionNameLength:
+		err = fmt.Errorf("name is longer than %d characters", maxCollectionNameLength)
+	case utf8.RuneCountInString(description) > maxCollectionDescriptionLength:
+		err = fmt.Errorf("description is longer than %d characters", maxCollectionDescriptionLength)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return "", "", false
+	}
+	return name, description, true
+}
+
+func (cfg *apiConfig) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	name, description, ok := decodeCollectionParams(w, r)
+	if !ok {
+		return
+	}
+	collection, err := cfg.db.CreateCollection(r.Context(), database.CreateCollectionParams{
+		UserID:      int64(userID),
+		Name:        name,
+		Description: description,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Collection with this name already exists", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create collection", err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, collectionResponse(collection))
+}
+
+// collectionFromRequest wczytuje kolekcję z {id} należącą do zalogowanego użytkownika.
+// Przy błędzie sam odpowiada klientowi i zwraca false.
+func (cfg *apiConfig) collectionFromRequest(w http.ResponseWriter, r *http.Request) (database.Collection, int, bool) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return database.Collection{}, 0, false
+	}
+	collectionID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID", err)
+		return database.Collection{}, 0, false
+	}
+	collection, err := cfg.db.GetCollectionForUser(r.Context(), database.GetCollectionForUserParams{
+		ID:     collectionID,
+		UserID: int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Collection not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get collection", err)
+		}
+		return database.Collection{}, 0, false
+	}
+	return collection, userID, true
+}
+
+// getCollectionHandler zwraca kolekcję razem z plikami w kolejności dodania
+func (cfg *apiConfig) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, userID, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	assets, err := cfg.db.ListCollectionAssets(r.Context(), collection.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list collection", err)
+		return
+	}
+	tags, err := cfg.stagedTagsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+
+	response := collectionResponse(collection)
+	response.ItemCount = int64(len(assets))
+	response.Images = make([]StagedImage, 0, len(assets))
+	for _, asset := range assets {
+		image := stagedImageFromRow(asset)
+		if assetTags, ok := tags[asset.Filename]; ok {
+			image.Tags = assetTags
+		}
+		response.Images = append(response.Images, image)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, userID, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	name, description, ok := decodeCollectionParams(w, r)
+	if !ok {
+		return
+	}
+	updated, err := cfg.db.UpdateCollection(r.Context(), database.UpdateCollectionParams{
+		Name:        name,
+		Description: description,
+		ID:          collection.ID,
+		UserID:      int64(userID),
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Collection with this name already exists", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update collection", err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, collectionResponse(updated))
+}
+
+// deleteCollectionHandler usuwa samą kolekcję - pliki zostają w poczekalni
+func (cfg *apiConfig) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, userID, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.db.DeleteCollection(r.Context(), database.DeleteCollectionParams{
+		ID:     collection.ID,
+		UserID: int64(userID),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete collection", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addCollectionItemsHandler dopisuje pliki z poczekalni na koniec kolekcji.
+// Pliki już obecne w kolekcji zostają na swoim miejscu.
+func (cfg *apiConfig) addCollectionItemsHandler(w http.ResponseWriter, r *http.Request) {
+	collection, userID, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		Filenames []string `json:"filenames"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	if len(p.Filenames) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No filenames provided", nil)
+		return
+	}
+
+	// Najpierw sprawdzamy wszystkie pliki, żeby nie dodać połowy listy
+	for _, filename := range p.Filenames {
+		_, err := cfg.db.GetStagedAssetForUser(r.Context(), database.GetStagedAssetForUserParams{
+			Filename: filename,
+			UserID:   int64(userID),
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = fmt.Errorf("file '%s' not found", filename)
+				respondWithError(w, http.StatusNotFound, err.Error(), err)
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't get staged image", err)
+			}
+			return
+		}
+	}
+	for _, filename := range p.Filenames {
+		err := cfg.db.AddCollectionItem(r.Context(), database.AddCollectionItemParams{
+			CollectionID: collection.ID,
+			Filename:     filename,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't add file to collection", err)
+			return
+		}
+	}
+	cfg.getCollectionHandler(w, r)
+}
+
+func (cfg *apiConfig) removeCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	collection, _, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.db.RemoveCollectionItem(r.Context(), database.RemoveCollectionItemParams{
+		CollectionID: collection.ID,
+		Filename:     r.PathValue("filename"),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove file from collection", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishCollectionHandler wysyła wszystkie pliki kolekcji na wskazaną stronę.
+// Wysłane pliki znikają z poczekalni (i z kolekcji), nieudane zostają do ponowienia.
+func (cfg *apiConfig) publishCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, userID, ok := cfg.collectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		Type string `json:"type"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	webType := WebsiteType(p.Type)
+	if !webType.IsValid() {
+		err := fmt.Errorf("invalid website type '%s' (use 'tattoo' or '3d')", p.Type)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	assets, err := cfg.db.ListCollectionAssets(r.Context(), collection.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list collection", err)
+		return
+	}
+	if len(assets) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Collection is empty", nil)
+		return
+	}
+
+	results := cfg.publishAssets(r.Context(), userID, assets, webType)
+	for i, result := range results {
+		if !result.Success {
+			continue
+		}
+		if _, err := cfg.removeStagedAsset(r.Context(), assets[i]); err != nil {
+			log.Printf("Couldn't remove published file %s: %v", result.Filename, err)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"message": "Upload process completed",
+		"results": results,
+	})
+}
+
+// isUniqueViolation rozpoznaje naruszenie ograniczenia UNIQUE w SQLite
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
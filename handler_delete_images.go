@@ -1,19 +1,75 @@
 package main
 
 import (
+	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
 )
 
 func (cfg *apiConfig) cleanupImagesHandler(w http.ResponseWriter, r *http.Request) {
-	cfg.cleanupImages()
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	// Bez parametru batch sprzątamy wszystkie partie użytkownika.
+	// Pliki trafiają do kosza, skąd można je przywrócić do czasu TRASH_RETENTION.
+	batchID := r.URL.Query().Get("batch")
+	if batchID == "" {
+		assets, err := cfg.db.ListStagedAssetsByUser(r.Context(), int64(userID))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list staged images", err)
+			return
+		}
+		if err := cfg.trashAssets(r.Context(), assets); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't move files to trash", err)
+			return
+		}
+		if err := cfg.removeUserStaging(r.Context(), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't clean staging", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Temp folder cleaned successfully",
+		})
+		return
+	}
+
+	if err := cfg.openBatch(r.Context(), userID, batchID); err != nil {
+		respondWithError(w, http.StatusNotFound, "Batch not found", err)
+		return
+	}
+	assets, err := cfg.db.ListStagedAssetsByBatch(r.Context(), database.ListStagedAssetsByBatchParams{
+		UserID:  int64(userID),
+		BatchID: batchID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list batch", err)
+		return
+	}
+	if err := cfg.trashAssets(r.Context(), assets); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move files to trash", err)
+		return
+	}
+	if err := cfg.removeBatch(r.Context(), userID, batchID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't clean batch", err)
+		return
+	}
 	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Temp folder cleaned successfully",
+		"message": "Batch cleaned successfully",
+		"batchId": batchID,
 	})
 }
 
 func (cfg *apiConfig) deleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
 	imgFilename := r.PathValue("filename")
 
 	if imgFilename == "" {
@@ -21,10 +77,17 @@ func (cfg *apiConfig) deleteImageHandler(w http.ResponseWriter, r *http.Request)
 		return // ✅ DODAJ
 	}
 
-	filePath := filepath.Join(cfg.tempRoot, imgFilename)
-	err := os.Remove(filePath)
+	asset, _, err := cfg.findStagedAsset(r.Context(), userID, imgFilename)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, errStagedFileNotFound) {
+			respondWithError(w, http.StatusNotFound, "File not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find file", err)
+		}
+		return
+	}
+	if err := cfg.trashStagedAsset(r.Context(), asset); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
 			respondWithError(w, http.StatusNotFound, "File not found", err)
 		} else {
 			respondWithError(w, http.StatusInternalServerError, "Couldn't delete file", err)
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+// editImageHandler dopisuje operacje do edycji pliku (albo je zeruje przy reset=true)
+// i przetwarza plik ponownie z zachowanego oryginału, podmieniając wynik w poczekalni
+func (cfg *apiConfig) editImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	type parameters struct {
+		Operations []imageEdit `json:"operations"`
+		Reset      bool        `json:"reset"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	if len(p.Operations) == 0 && !p.Reset {
+		respondWithError(w, http.StatusBadRequest, "No operations provided", nil)
+		return
+	}
+
+	asset, key, err := cfg.findStagedAsset(r.Context(), userID, r.PathValue("filename"))
+	if err != nil {
+		if errors.Is(err, errStagedFileNotFound) {
+			respondWithError(w, http.StatusNotFound, "File not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find file", err)
+		}
+		return
+	}
+	if asset.OriginalFile == "" {
+		respondWithError(w, http.StatusConflict, "Original of this file was not retained", nil)
+		return
+	}
+
+	edits, err := parseEdits(asset.Edits)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Stored edits are corrupted", err)
+		return
+	}
+	if p.Reset {
+		edits = nil
+	}
+	for i, op := range p.Operations {
+		normalized, effective, err := normalizeEdit(op)
+		if err != nil {
+			err = fmt.Errorf("operation %d: %w", i+1, err)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		if effective {
+			edits = appendEdit(edits, normalized)
+		}
+	}
+	if len(edits) > maxEdits {
+		err := fmt.Errorf("image has %d edits, limit is %d - reset it to start over", len(edits), maxEdits)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	updated, err := cfg.reprocessStagedAsset(r.Context(), asset, key, edits)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't apply edits", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stagedImage(r.Context(), updated))
+}
+
+// reprocessStagedAsset przetwarza plik od nowa z oryginału z podanymi edycjami
+// tym samym potokiem co przy uploadzie i podmienia plik WebP pod tą samą nazwą
+func (cfg *apiConfig) reprocessStagedAsset(ctx context.Context, asset database.StagedAsset, key string, edits []imageEdit) (database.StagedAsset, error) {
+	_, pipeline, err := cfg.resolvePipeline(ctx, asset.Preset, asset.Destination, asset.AutoQuality == 1)
+	if err != nil {
+		return database.StagedAsset{}, err
+	}
+
+	// Dekodery potrzebują Seek, więc oryginał z magazynu trafia najpierw do pliku roboczego
+	file, err := cfg.fetchToScratch(ctx, cfg.staging, stagingKey(int(asset.UserID), asset.BatchID, asset.OriginalFile))
+	if err != nil {
+		return database.StagedAsset{}, fmt.Errorf("couldn't open original: %w", err)
+	}
+	defer file.Close()
+
+	meta := sourceMeta{Orientation: exifOrientation(file, asset.MediaType)}
+	img, err := decodeImage(file, asset.MediaType)
+	if err != nil {
+		return database.StagedAsset{}, err
+	}
+	img, err = pipeline.runWithEdits(img, meta, edits)
+	if err != nil {
+		return database.StagedAsset{}, err
+	}
+
+	workPath := cfg.scratchPath()
+	defer os.Remove(workPath)
+	webpSize, metrics, err := cfg.encodeWithMetrics(img, workPath, pipeline.encode)
+	if err != nil {
+		return database.StagedAsset{}, err
+	}
+	width, height, err := webpDimensions(workPath)
+	if err != nil {
+		return database.StagedAsset{}, err
+	}
+
+	editsJSON, err := json.Marshal(edits)
+	if err != nil {
+		return database.StagedAsset{}, fmt.Errorf("couldn't encode edits: %w", err)
+	}
+	if edits == nil {
+		editsJSON = []byte("[]")
+	}
+	if err := cfg.putStagedFile(ctx, key, workPath); err != nil {
+		return database.StagedAsset{}, fmt.Errorf("couldn't replace WebP file: %w", err)
+	}
+	return cfg.db.UpdateStagedAssetOutput(ctx, database.UpdateStagedAssetOutputParams{
+		WebpSize: webpSize,
+		Width:    int64(width),
+		Height:   int64(height),
+		Ssim:     metrics.SSIM,
+		Quality:  float64(metrics.Quality),
+		Edits:    string(editsJSON),
+		Filename: asset.Filename,
+		UserID:   asset.UserID,
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+// Limity długości pól - WordPress przyjmie więcej, ale tyle w zupełności wystarcza
+const (
+	maxTitleLength       = 255
+	maxAltTextLength     = 255
+	maxCaptionLength     = 2000
+	maxDescriptionLength = 10000
+)
+
+// mediaMetadata to opis obrazka wysyłany do WordPressa razem z plikiem
+type mediaMetadata struct {
+	Title       string `json:"title"`
+	AltText     string `json:"altText"`
+	Caption     string `json:"caption"`
+	Description string `json:"description"`
+	// Date to data wykonania zdjęcia - WordPress pokaże ją jako datę pliku w bibliotece
+	Date *time.Time `json:"date,omitempty"`
+}
+
+func (m mediaMetadata) isEmpty() bool {
+	return m == mediaMetadata{}
+}
+
+func metadataFromAsset(asset database.StagedAsset) mediaMetadata {
+	return mediaMetadata{
+		Title:       asset.Title,
+		AltText:     asset.AltText,
+		Caption:     asset.Caption,
+		Description: asset.Description,
+		Date:        asset.CapturedAt,
+	}
+}
+
+// updateImageMetadataHandler zmienia opis pliku w poczekalni.
+// Pola pominięte w żądaniu zostają bez zmian, pusty string czyści pole.
+func (cfg *apiConfig) updateImageMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	filename := r.PathValue("filename")
+
+	type parameters struct {
+		Title       *string `json:"title"`
+		AltText     *string `json:"altText"`
+		Caption     *string `json:"caption"`
+		Description *string `json:"description"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+
+	asset, err := cfg.db.GetStagedAssetForUser(r.Context(), database.GetStagedAssetForUserParams{
+		Filename: filename,
+		UserID:   int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "File not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get staged image", err)
+		}
+		return
+	}
+
+	meta := metadataFromAsset(asset)
+	fields := []struct {
+		name  string
+		value *string
+		dst   *string
+		limit int
+	}{
+		{"title", p.Title, &meta.Title, maxTitleLength},
+		{"altText", p.AltText, &meta.AltText, maxAltTextLength},
+		{"caption", p.Caption, &meta.Caption, maxCaptionLength},
+		{"description", p.Description, &meta.Description, maxDescriptionLength},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*f.value)
+		if utf8.RuneCountInString(value) > f.limit {
+			err := fmt.Errorf("%s is longer than %d characters", f.name, f.limit)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		*f.dst = value
+	}
+
+	updated, err := cfg.db.UpdateStagedAssetMetadata(r.Context(), database.UpdateStagedAssetMetadataParams{
+		Title:       meta.Title,
+		AltText:     meta.AltText,
+		Caption:     meta.Caption,
+		Description: meta.Description,
+		Filename:    asset.Filename,
+		UserID:      int64(userID),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update metadata", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stagedImage(r.Context(), updated))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Import z katalogu działa tylko pod IMPORT_ROOT (np. zamontowany udział NAS).
+// Klient podaje ścieżkę względną, a każdy plik - także wskazany przez dowiązanie
+// symboliczne - musi po rozwiązaniu leżeć pod tym katalogiem.
+
+const maxDirectoryImportFiles = 1000
+
+var errOutsideImportRoot = errors.New("path is outside of the import root")
+
+type DirectoryImportResult struct {
+	Path    string     `json:"path"`
+	Image   *ImageInfo `json:"image,omitempty"`
+	Skipped bool       `json:"skipped,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type DirectoryImportResponse struct {
+	BatchID string                  `json:"batchId,omitempty"`
+	Results []DirectoryImportResult `json:"results"`
+}
+
+// importDirectoryHandler przetwarza obrazki z katalogu pod IMPORT_ROOT.
+// Wzorce w "include" (np. "*.jpg", "IMG_*") dopasowujemy do nazwy pliku bez względu na wielkość liter.
+func (cfg *apiConfig) importDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	if cfg.importRoot == "" {
+		respondWithError(w, http.StatusNotFound, "Directory import is not configured", nil)
+		return
+	}
+
+	type parameters struct {
+		Path      string   `json:"path"`
+		Recursive bool     `json:"recursive"`
+		Include   []string `json:"include"`
+		Batch     string   `json:"batch"`
+		uploadSettings
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	for _, pattern := range p.Include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			err = fmt.Errorf("invalid include pattern '%s'", pattern)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if _, _, err := cfg.resolvePipeline(r.Context(), p.Preset, p.Destination, p.AutoQuality); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dir, err := cfg.resolveImportPath(p.Path)
+	if err != nil {
+		if errors.Is(err, errOutsideImportRoot) {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		} else {
+			respondWithError(w, http.StatusNotFound, "Directory not found", err)
+		}
+		return
+	}
+
+	results, sources, sourceResults, err := cfg.collectDirectorySources(dir, p.Recursive, p.Include)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(sources) == 0 {
+		respondWithJSON(w, http.StatusOK, DirectoryImportResponse{Results: results})
+		return
+	}
+	var total int64
+	for _, source := range sources {
+		total += source.Size
+	}
+	if !cfg.enforceQuota(w, r, userID, len(sources), total) {
+		return
+	}
+
+	batchID, ok := cfg.resolveBatchOrRespond(w, r, userID, p.Batch)
+	if !ok {
+		return
+	}
+	opts, err := cfg.processOptionsFor(r.Context(), userID, batchID, p.uploadSettings)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	for i, result := range cfg.processSources(r.Context(), sources, opts) {
+		entry := &results[sourceResults[i]]
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+			continue
+		}
+		info := result.ImageInfo
+		entry.Image = &info
+	}
+
+	log.Printf("✓ Zaimportowano %d plików z katalogu %s w %v\n",
+		len(sources), dir, time.Since(startTime))
+
+	respondWithJSON(w, http.StatusOK, DirectoryImportResponse{
+		BatchID: batchID,
+		Results: results,
+	})
+}
+
+// resolveImportPath zamienia ścieżkę względną na katalog pod IMPORT_ROOT
+func (cfg *apiConfig) resolveImportPath(rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", errOutsideImportRoot
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(cfg.importRoot, filepath.Clean("/"+rel)))
+	if err != nil {
+		return "", err
+	}
+	if !cfg.insideImportRoot(dir) {
+		return "", errOutsideImportRoot
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", rel)
+	}
+	return dir, nil
+}
+
+// insideImportRoot sprawdza już rozwiązaną ścieżkę (IMPORT_ROOT też jest rozwiązany przy starcie)
+func (cfg *apiConfig) insideImportRoot(p string) bool {
+	rel, err := filepath.Rel(cfg.importRoot, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// collectDirectorySources zbiera pliki do przetworzenia i wyniki dla pominiętych.
+// sourceResults[i] to indeks wyniku dla sources[i].
+func (cfg *apiConfig) collectDirectorySources(dir string, recursive bool, include []string) ([]DirectoryImportResult, []imageSource, []int, error) {
+	results := []DirectoryImportResult{}
+	var sources []imageSource
+	var sourceResults []int
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || !matchesInclude(d.Name(), include) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(cfg.importRoot, p)
+		result := DirectoryImportResult{Path: filepath.ToSlash(rel)}
+		if _, ok := extensionMediaTypes[strings.ToLower(filepath.Ext(p))]; !ok {
+			result.Skipped = true
+			results = append(results, result)
+			return nil
+		}
+		// Dowiązanie mogłoby wskazywać plik spoza IMPORT_ROOT
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil || !cfg.insideImportRoot(resolved) {
+			result.Error = errOutsideImportRoot.Error()
+			results = append(results, result)
+			return nil
+		}
+		info, err := os.Stat(resolved)
+		if err != nil || !info.Mode().IsRegular() {
+			result.Skipped = true
+			results = append(results, result)
+			return nil
+		}
+		if len(sources) == maxDirectoryImportFiles {
+			return fmt.Errorf("directory has more than %d images, narrow it down with include patterns", maxDirectoryImportFiles)
+		}
+
+		sources = append(sources, imageSource{
+			Name: d.Name(),
+			Size: info.Size(),
+			open: func() (multipart.File, error) {
+				return os.Open(resolved)
+			},
+		})
+		sourceResults = append(sourceResults, len(results))
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return results, sources, sourceResults, nil
+}
+
+// matchesInclude dopasowuje nazwę do wzorców; brak wzorców = wszystkie pliki
+func matchesInclude(name string, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, pattern := range include {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	maxImportURLs           = 50
+	defaultImportMaxBytes   = 200 << 20 // 200 MB na plik
+	defaultImportTimeout    = time.Minute
+	defaultImportedFilename = "image"
+
+	// Łączny czas pobierania wszystkich adresów z jednego żądania - bez niego
+	// 50 adresów po importTimeout każdy trzymałoby połączenie prawie godzinę
+	maxImportDuration = 5 * time.Minute
+)
+
+var errImportTooLarge = errors.New("file is too large")
+
+type ImportResult struct {
+	URL   string     `json:"url"`
+	Image *ImageInfo `json:"image,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	BatchID string         `json:"batchId,omitempty"`
+	Results []ImportResult `json:"results"`
+}
+
+// importImagesHandler pobiera obrazki spod podanych adresów i przetwarza je jak upload.
+// Błąd jednego adresu nie przerywa pozostałych.
+func (cfg *apiConfig) importImagesHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	type parameters struct {
+		URLs  []string `json:"urls"`
+		Batch string   `json:"batch"`
+		uploadSettings
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+	if len(p.URLs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No URLs provided", nil)
+		return
+	}
+	if len(p.URLs) > maxImportURLs {
+		err := fmt.Errorf("%d URLs provided, limit is %d", len(p.URLs), maxImportURLs)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if _, _, err := cfg.resolvePipeline(r.Context(), p.Preset, p.Destination, p.AutoQuality); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	// Liczbę plików sprawdzamy przed pobieraniem, a bajty na bieżąco z pozostałego
+	// limitu - inaczej pobralibyśmy nawet 50 × 200 MB tylko po to, żeby je odrzucić
+	if !cfg.enforceQuota(w, r, userID, len(p.URLs), 0) {
+		return
+	}
+	remaining, err := cfg.remainingQuotaBytes(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check quota", err)
+		return
+	}
+
+	// Najpierw pobieramy wszystko do plików roboczych - dopiero wtedy znamy rozmiary do limitu
+	client := newImportClient(cfg.importAllowlist, cfg.importTimeout)
+	fetchCtx, cancel := context.WithTimeout(r.Context(), maxImportDuration)
+	defer cancel()
+	results := make([]ImportResult, len(p.URLs))
+	var sources []imageSource
+	var sourceResults []int
+	var total int64
+	for i, rawURL := range p.URLs {
+		results[i].URL = rawURL
+		limit, quotaBound := cfg.importMaxBytes, false
+		if remaining != nil && *remaining-total < limit {
+			limit, quotaBound = *remaining-total, true
+		}
+		if limit <= 0 {
+			results[i].Error = fmt.Errorf("%w: no staging space left", errQuotaExceeded).Error()
+			continue
+		}
+		if fetchCtx.Err() != nil {
+			results[i].Error = fmt.Sprintf("skipped: import exceeded %v", maxImportDuration)
+			continue
+		}
+		source, err := cfg.fetchImportSource(fetchCtx, client, rawURL, limit)
+		if err != nil {
+			if quotaBound && errors.Is(err, errImportTooLarge) {
+				err = fmt.Errorf("%w: file doesn't fit in the remaining %d bytes", errQuotaExceeded, limit)
+			}
+			results[i].Error = err.Error()
+			continue
+		}
+		defer os.Remove(source.path)
+		sources = append(sources, source.imageSource)
+		sourceResults = append(sourceResults, i)
+		total += source.Size
+	}
+	if len(sources) == 0 {
+		respondWithJSON(w, http.StatusOK, ImportResponse{Results: results})
+		return
+	}
+	if !cfg.enforceQuota(w, r, userID, len(sources), total) {
+		return
+	}
+
+	batchID, ok := cfg.resolveBatchOrRespond(w, r, userID, p.Batch)
+	if !ok {
+		return
+	}
+	opts, err := cfg.processOptionsFor(r.Context(), userID, batchID, p.uploadSettings)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	for i, result := range cfg.processSources(r.Context(), sources, opts) {
+		entry := &results[sourceResults[i]]
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+			continue
+		}
+		info := result.ImageInfo
+		entry.Image = &info
+	}
+
+	log.Printf("✓ Zaimportowano %d plików z %d adresów w %v\n",
+		len(sources), len(p.URLs), time.Since(startTime))
+
+	respondWithJSON(w, http.StatusOK, ImportResponse{
+		BatchID: batchID,
+		Results: results,
+	})
+}
+
+// importedSource to pobrany plik czekający w katalogu roboczym na przetworzenie
+type importedSource struct {
+	imageSource
+	path string
+}
+
+// fetchImportSource pobiera adres do pliku roboczego, najwyżej maxBytes bajtów
+func (cfg *apiConfig) fetchImportSource(ctx context.Context, client *http.Client, rawURL string, maxBytes int64) (importedSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return importedSource{}, fmt.Errorf("invalid URL (only http and https are supported)")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return importedSource{}, fmt.Errorf("couldn't create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return importedSource{}, fmt.Errorf("couldn't fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return importedSource{}, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return importedSource{}, fmt.Errorf("%w: limit is %d bytes", errImportTooLarge, maxBytes)
+	}
+
+	source := imageSource{
+		Name:        importedFilename(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	// Typ sprawdzamy po nagłówkach, zanim pobierzemy całą treść
+	if _, err := validateImageType(source); err != nil {
+		return importedSource{}, err
+	}
+
+	file, err := os.Create(cfg.scratchPath())
+	if err != nil {
+		return importedSource{}, fmt.Errorf("couldn't create scratch file: %w", err)
+	}
+	// Content-Length może kłamać albo go nie być - czytamy najwyżej bajt więcej niż limit
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxBytes+1))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxBytes {
+		err = fmt.Errorf("%w: limit is %d bytes", errImportTooLarge, maxBytes)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return importedSource{}, fmt.Errorf("couldn't download: %w", err)
+	}
+
+	filePath := file.Name()
+	source.Size = n
+	source.open = func() (multipart.File, error) {
+		return os.Open(filePath)
+	}
+	return importedSource{imageSource: source, path: filePath}, nil
+}
+
+// importedFilename bierze nazwę z Content-Disposition albo z ostatniego segmentu adresu
+// (po przekierowaniach). Nazwa służy tylko jako źródło sluga i rozszerzenia.
+func importedFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(params["filename"]); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" && name != "" {
+		return name
+	}
+	return defaultImportedFilename
+}
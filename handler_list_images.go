@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/google/uuid"
+)
+
+type StagedImage struct {
+	Filename     string      `json:"filename"`
+	OriginalName string      `json:"originalName"`
+	BatchID      string      `json:"batchId"`
+	OriginalSize int64       `json:"originalSize"`
+	WebpSize     int64       `json:"webpSize"`
+	Width        int64       `json:"width"`
+	Height       int64       `json:"height"`
+	Preset       string      `json:"preset"`
+	SSIM         float64     `json:"ssim"`
+	Quality      float64     `json:"quality"`
+	Title        string      `json:"title"`
+	AltText      string      `json:"altText"`
+	Caption      string      `json:"caption"`
+	Description  string      `json:"description"`
+	Edits        []imageEdit `json:"edits"`
+	PreviewURL   string      `json:"previewUrl"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	CapturedAt   *time.Time  `json:"capturedAt,omitempty"`
+	CameraModel  string      `json:"cameraModel,omitempty"`
+	Keywords     []string    `json:"keywords"`
+	Tags         []string    `json:"tags"`
+}
+
+// listImagesHandler zwraca pliki użytkownika czekające w poczekalni,
+// żeby odświeżona karta przeglądarki mogła odtworzyć swój stan.
+// Parametr tag zawęża listę do plików z tym tagiem.
+func (cfg *apiConfig) listImagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	var assets []database.StagedAsset
+	var err error
+	if batchID := r.URL.Query().Get("batch"); batchID != "" {
+		if _, parseErr := uuid.Parse(batchID); parseErr != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid batch ID", parseErr)
+			return
+		}
+		assets, err = cfg.db.ListStagedAssetsByBatch(r.Context(), database.ListStagedAssetsByBatchParams{
+			UserID:  int64(userID),
+			BatchID: batchID,
+		})
+	} else {
+		assets, err = cfg.db.ListStagedAssetsByUser(r.Context(), int64(userID))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list staged images", err)
+		return
+	}
+
+	tags, err := cfg.stagedTagsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+	tagFilter := strings.TrimSpace(r.URL.Query().Get("tag"))
+
+	images := make([]StagedImage, 0, len(assets))
+	for _, asset := range assets {
+		image := stagedImageFromRow(asset)
+		if assetTags, ok := tags[asset.Filename]; ok {
+			image.Tags = assetTags
+		}
+		if tagFilter != "" && !hasTag(image.Tags, tagFilter) {
+			continue
+		}
+		images = append(images, image)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"images": images,
+	})
+}
+
+func stagedImageFromRow(asset database.StagedAsset) StagedImage {
+	edits, err := parseEdits(asset.Edits)
+	if err != nil || edits == nil {
+		edits = []imageEdit{}
+	}
+	return StagedImage{
+		Filename:     asset.Filename,
+		OriginalName: asset.OriginalName,
+		BatchID:      asset.BatchID,
+		OriginalSize: asset.OriginalSize,
+		WebpSize:     asset.WebpSize,
+		Width:        asset.Width,
+		Height:       asset.Height,
+		Preset:       asset.Preset,
+		SSIM:         asset.Ssim,
+		Quality:      asset.Quality,
+		Title:        asset.Title,
+		AltText:      asset.AltText,
+		Caption:      asset.Caption,
+		Description:  asset.Description,
+		Edits:        edits,
+		PreviewURL:   stagingURL(int(asset.UserID), asset.BatchID, asset.Filename),
+		CreatedAt:    asset.CreatedAt,
+		CapturedAt:   asset.CapturedAt,
+		CameraModel:  asset.CameraModel,
+		Keywords:     parseKeywords(asset.Keywords),
+		Tags:         []string{},
+	}
+}
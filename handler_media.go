@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+const (
+	defaultMediaPageSize = 50
+	maxMediaPageSize     = 200
+	maxSearchTerms       = 10
+)
+
+// PublishedImage to plik wysłany do WordPressa (wpis w upload_history)
+type PublishedImage struct {
+	ID           int64     `json:"id"`
+	Filename     string    `json:"filename"`
+	WebsiteType  string    `json:"websiteType"`
+	WordPressID  *int64    `json:"wordpressId"`
+	WordPressURL *string   `json:"wordpressUrl"`
+	Title        *string   `json:"title"`
+	AltText      *string   `json:"altText"`
+	Caption      *string   `json:"caption"`
+	ThumbnailURL *string   `json:"thumbnailUrl"`
+	BatchID      *string   `json:"batchId"`
+	WebpSize     int64     `json:"webpSize"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Tags         []string  `json:"tags"`
+}
+
+func publishedImageFromRow(row database.UploadHistory) PublishedImage {
+	image := PublishedImage{
+		ID:           row.ID,
+		Filename:     row.Filename,
+		WebsiteType:  row.WebsiteType,
+		WordPressID:  row.WordpressID,
+		WordPressURL: row.WordpressUrl,
+		Title:        row.Title,
+		AltText:      row.AltText,
+		Caption:      row.Caption,
+		ThumbnailURL: row.ThumbnailUrl,
+		BatchID:      row.BatchID,
+		WebpSize:     row.WebpSize,
+		CreatedAt:    row.CreatedAt,
+		Tags:         []string{},
+	}
+	// Wpisy sprzed zapisywania miniatur pokazują pełny plik
+	if image.ThumbnailURL == nil {
+		image.ThumbnailURL = row.WordpressUrl
+	}
+	return image
+}
+
+// parsePage czyta limit i offset z zapytania
+func parsePage(r *http.Request) (int64, int64, error) {
+	limit, offset := int64(defaultMediaPageSize), int64(0)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxMediaPageSize {
+			return 0, 0, errors.New("limit must be between 1 and 200")
+		}
+		limit = parsed
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+		offset = parsed
+	}
+	return limit, offset, nil
+}
+
+// listMediaHandler zwraca pliki opublikowane przez użytkownika, od najnowszych.
+// Parametr tag zawęża listę do plików z tym tagiem.
+func (cfg *apiConfig) listMediaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	var rows []database.UploadHistory
+	if tag := strings.TrimSpace(r.URL.Query().Get("tag")); tag != "" {
+		rows, err = cfg.db.ListPublishedByUserAndTag(r.Context(), database.ListPublishedByUserAndTagParams{
+			UserID: int64(userID),
+			Name:   tag,
+			Limit:  limit,
+			Offset: offset,
+		})
+	} else {
+		rows, err = cfg.db.ListPublishedByUser(r.Context(), database.ListPublishedByUserParams{
+			UserID: int64(userID),
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list media", err)
+		return
+	}
+
+	media, err := cfg.publishedImagesWithTags(r.Context(), userID, rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"media":  media,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// searchMediaHandler przeszukuje opublikowane pliki użytkownika (nazwa, tytuł, alt,
+// podpis, tagi, strona) i zwraca je od najlepiej dopasowanych
+func (cfg *apiConfig) searchMediaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	match := mediaSearchQuery(q)
+	if match == "" {
+		respondWithError(w, http.StatusBadRequest, "Query is required", nil)
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.db.SearchMedia(r.Context(), database.SearchMediaParams{
+		Query:  match,
+		UserID: int64(userID),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search media", err)
+		return
+	}
+	media, err := cfg.publishedImagesWithTags(r.Context(), userID, rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"query":  q,
+		"media":  media,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// mediaSearchQuery zamienia tekst od użytkownika na zapytanie FTS5: każde słowo
+// jest dopasowywane jako prefiks, a wszystkie muszą wystąpić. Składnia FTS5
+// (cudzysłowy, OR, NEAR, ...) z wejścia nie przechodzi - zostają same litery i cyfry.
+func mediaSearchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// publishedImagesWithTags buduje odpowiedź listy razem z tagami plików
+func (cfg *apiConfig) publishedImagesWithTags(ctx context.Context, userID int, rows []database.UploadHistory) ([]PublishedImage, error) {
+	tagRows, err := cfg.db.ListUploadTagsByUser(ctx, int64(userID))
+	if err != nil {
+		return nil, err
+	}
+	tags := map[int64][]string{}
+	for _, row := range tagRows {
+		tags[row.UploadID] = append(tags[row.UploadID], row.Name)
+	}
+	media := make([]PublishedImage, 0, len(rows))
+	for _, row := range rows {
+		image := publishedImageFromRow(row)
+		if uploadTags, ok := tags[row.ID]; ok {
+			image.Tags = uploadTags
+		}
+		media = append(media, image)
+	}
+	return media, nil
+}
+
+// setMediaTagsHandler zastępuje tagi opublikowanego pliku
+func (cfg *apiConfig) setMediaTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	uploadID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media ID", err)
+		return
+	}
+	tags, ok := decodeTagsParams(w, r)
+	if !ok {
+		return
+	}
+
+	row, err := cfg.db.GetPublishedForUser(r.Context(), database.GetPublishedForUserParams{
+		ID:     uploadID,
+		UserID: int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Media not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get media", err)
+		}
+		return
+	}
+	if err := cfg.setUploadTags(r.Context(), row.ID, tags); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save tags", err)
+		return
+	}
+
+	image := publishedImageFromRow(row)
+	if saved, err := cfg.db.ListTagsForUpload(r.Context(), row.ID); err == nil {
+		image.Tags = tagNames(saved)
+	}
+	respondWithJSON(w, http.StatusOK, image)
+}
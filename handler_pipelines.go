@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+type PipelineResponse struct {
+	Destination string         `json:"destination"`
+	Steps       []PipelineStep `json:"steps"`
+	UpdatedAt   *time.Time     `json:"updatedAt,omitempty"`
+	IsDefault   bool           `json:"isDefault"`
+}
+
+func (cfg *apiConfig) listPipelinesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.db.ListPipelines(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list pipelines", err)
+		return
+	}
+
+	pipelines := []PipelineResponse{}
+	for _, row := range rows {
+		resp, err := pipelineResponseFromRow(row)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Stored pipeline is corrupted", err)
+			return
+		}
+		pipelines = append(pipelines, resp)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"pipelines": pipelines,
+	})
+}
+
+func (cfg *apiConfig) getPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	destination := WebsiteType(r.PathValue("destination"))
+	if !destination.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid destination", nil)
+		return
+	}
+
+	row, err := cfg.db.GetPipeline(r.Context(), string(destination))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Brak zapisanego potoku - destynacja używa domyślnego
+			respondWithJSON(w, http.StatusOK, PipelineResponse{
+				Destination: string(destination),
+				Steps:       defaultPipeline().Steps,
+				IsDefault:   true,
+			})
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get pipeline", err)
+		return
+	}
+
+	resp, err := pipelineResponseFromRow(row)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Stored pipeline is corrupted", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) savePipelineHandler(w http.ResponseWriter, r *http.Request) {
+	destination := WebsiteType(r.PathValue("destination"))
+	if !destination.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid destination", nil)
+		return
+	}
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	var p Pipeline
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return
+	}
+
+	// Walidacja przy zapisie - do bazy trafiają tylko potoki, które da się uruchomić
+	preset, _ := getPreset(defaultPresetName)
+	if _, err := cfg.compilePipeline(r.Context(), p, preset); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid pipeline: %v", err), err)
+		return
+	}
+
+	steps, err := json.Marshal(p.Steps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't encode pipeline", err)
+		return
+	}
+	updatedBy := int64(userID)
+	row, err := cfg.db.UpsertPipeline(r.Context(), database.UpsertPipelineParams{
+		Destination: string(destination),
+		Steps:       string(steps),
+		UpdatedBy:   &updatedBy,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save pipeline", err)
+		return
+	}
+
+	resp, err := pipelineResponseFromRow(row)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Stored pipeline is corrupted", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) deletePipelineHandler(w http.ResponseWriter, r *http.Request) {
+	destination := WebsiteType(r.PathValue("destination"))
+	if !destination.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid destination", nil)
+		return
+	}
+	if err := cfg.db.DeletePipeline(r.Context(), string(destination)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete pipeline", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pipelineFor zwraca skompilowany potok destynacji albo domyślny, gdy
+// destynacja nie została podana lub nie ma zapisanego potoku
+func (cfg *apiConfig) pipelineFor(ctx context.Context, destination string, preset imagePreset) (compiledPipeline, error) {
+	p := defaultPipeline()
+	if destination != "" {
+		webType := WebsiteType(destination)
+		if !webType.IsValid() {
+			return compiledPipeline{}, fmt.Errorf("invalid destination '%s' (use 'tattoo' or '3d')", destination)
+		}
+		row, err := cfg.db.GetPipeline(ctx, destination)
+		if err == nil {
+			if err := json.Unmarshal([]byte(row.Steps), &p.Steps); err != nil {
+				return compiledPipeline{}, fmt.Errorf("couldn't parse stored pipeline: %w", err)
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return compiledPipeline{}, fmt.Errorf("couldn't get pipeline: %w", err)
+		}
+	}
+	return cfg.compilePipeline(ctx, p, preset)
+}
+
+func pipelineResponseFromRow(row database.Pipeline) (PipelineResponse, error) {
+	var steps []PipelineStep
+	if err := json.Unmarshal([]byte(row.Steps), &steps); err != nil {
+		return PipelineResponse{}, err
+	}
+	updatedAt := row.UpdatedAt
+	return PipelineResponse{
+		Destination: row.Destination,
+		Steps:       steps,
+		UpdatedAt:   &updatedAt,
+	}, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+type QuotaResponse struct {
+	Role      string    `json:"role,omitempty"`
+	UserID    int64     `json:"userId,omitempty"`
+	MaxBytes  *int64    `json:"maxBytes"`
+	MaxFiles  *int64    `json:"maxFiles"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// quotaHandler pokazuje zalogowanemu użytkownikowi jego limity i bieżące zajęcie poczekalni
+func (cfg *apiConfig) quotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	limits, err := cfg.quotaFor(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+	usage, err := cfg.stagingUsageFor(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get staging usage", err)
+		return
+	}
+
+	// Pozostałe miejsce - nil tam, gdzie nie ma limitu
+	type remaining struct {
+		Files *int64 `json:"files"`
+		Bytes *int64 `json:"bytes"`
+	}
+	var left remaining
+	if limits.MaxFiles != nil {
+		files := max(*limits.MaxFiles-usage.Files, 0)
+		left.Files = &files
+	}
+	if limits.MaxBytes != nil {
+		bytes := max(*limits.MaxBytes-usage.Bytes, 0)
+		left.Bytes = &bytes
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"limits":    limits,
+		"usage":     usage,
+		"remaining": left,
+	})
+}
+
+type quotaParams struct {
+	MaxBytes *int64 `json:"maxBytes"`
+	MaxFiles *int64 `json:"maxFiles"`
+}
+
+// decodeQuotaParams czyta limity z ciała żądania; null albo brak pola = bez limitu
+func decodeQuotaParams(w http.ResponseWriter, r *http.Request) (quotaParams, bool) {
+	var p quotaParams
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return quotaParams{}, false
+	}
+	if (p.MaxBytes != nil && *p.MaxBytes < 0) || (p.MaxFiles != nil && *p.MaxFiles < 0) {
+		respondWithError(w, http.StatusBadRequest, "Limits can't be negative", nil)
+		return quotaParams{}, false
+	}
+	return p, true
+}
+
+func (cfg *apiConfig) listQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	roleRows, err := cfg.db.ListRoleQuotas(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list role quotas", err)
+		return
+	}
+	userRows, err := cfg.db.ListUserQuotas(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list user quotas", err)
+		return
+	}
+
+	roles := []QuotaResponse{}
+	for _, row := range roleRows {
+		roles = append(roles, roleQuotaResponse(row))
+	}
+	users := []QuotaResponse{}
+	for _, row := range userRows {
+		users = append(users, userQuotaResponse(row))
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"roles": roles,
+		"users": users,
+	})
+}
+
+func (cfg *apiConfig) saveRoleQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.PathValue("role")
+	if !validRoles[role] {
+		respondWithError(w, http.StatusBadRequest, "Invalid role", nil)
+		return
+	}
+	adminID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	p, ok := decodeQuotaParams(w, r)
+	if !ok {
+		return
+	}
+
+	updatedBy := int64(adminID)
+	row, err := cfg.db.UpsertRoleQuota(r.Context(), database.UpsertRoleQuotaParams{
+		Role:      role,
+		MaxBytes:  p.MaxBytes,
+		MaxFiles:  p.MaxFiles,
+		UpdatedBy: &updatedBy,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save quota", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, roleQuotaResponse(row))
+}
+
+func (cfg *apiConfig) deleteRoleQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.PathValue("role")
+	if !validRoles[role] {
+		respondWithError(w, http.StatusBadRequest, "Invalid role", nil)
+		return
+	}
+	if err := cfg.db.DeleteRoleQuota(r.Context(), role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete quota", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) saveUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	adminID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	p, ok := decodeQuotaParams(w, r)
+	if !ok {
+		return
+	}
+	if _, err := cfg.db.GetUser(r.Context(), userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		}
+		return
+	}
+
+	updatedBy := int64(adminID)
+	row, err := cfg.db.UpsertUserQuota(r.Context(), database.UpsertUserQuotaParams{
+		UserID:    userID,
+		MaxBytes:  p.MaxBytes,
+		MaxFiles:  p.MaxFiles,
+		UpdatedBy: &updatedBy,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save quota", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userQuotaResponse(row))
+}
+
+// deleteUserQuotaHandler usuwa limit użytkownika - znów obowiązuje limit jego roli
+func (cfg *apiConfig) deleteUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if err := cfg.db.DeleteUserQuota(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete quota", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func roleQuotaResponse(row database.RoleQuota) QuotaResponse {
+	return QuotaResponse{
+		Role:      row.Role,
+		MaxBytes:  row.MaxBytes,
+		MaxFiles:  row.MaxFiles,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
+
+func userQuotaResponse(row database.UserQuota) QuotaResponse {
+	return QuotaResponse{
+		UserID:    row.UserID,
+		MaxBytes:  row.MaxBytes,
+		MaxFiles:  row.MaxFiles,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
 )
 
 type WPMediaResponse struct {
@@ -16,8 +19,24 @@ type WPMediaResponse struct {
 	Title     struct {
 		Rendered string `json:"rendered"`
 	} `json:"title"`
-	MediaType string `json:"media_type"`
-	MimeType  string `json:"mime_type"`
+	MediaType    string `json:"media_type"`
+	MimeType     string `json:"mime_type"`
+	MediaDetails struct {
+		Sizes map[string]struct {
+			SourceURL string `json:"source_url"`
+		} `json:"sizes"`
+	} `json:"media_details"`
+}
+
+// ThumbnailURL zwraca najmniejszy rozmiar wygenerowany przez WordPressa,
+// a gdy go nie ma (np. mały plik) - adres oryginału
+func (w *WPMediaResponse) ThumbnailURL() string {
+	for _, size := range []string{"thumbnail", "medium"} {
+		if s, ok := w.MediaDetails.Sizes[size]; ok && s.SourceURL != "" {
+			return s.SourceURL
+		}
+	}
+	return w.SourceURL
 }
 
 type WebsiteType string
@@ -35,84 +54,176 @@ type UploadResult struct {
 	Filename     string `json:"filename"`
 	WordPressID  int    `json:"wordpressId,omitempty"`
 	WordPressURL string `json:"wordpressUrl,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
 	Success      bool   `json:"success"`
 	Error        string `json:"error,omitempty"`
+	Warning      string `json:"warning,omitempty"`
 }
 
 func (cfg *apiConfig) sendImagesHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse website type
-	webType, err := getWebsiteType(r)
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	// Parse website type and batch
+	webType, batchID, err := getSendParams(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid website type", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid send parameters", err)
+		return
+	}
+
+	if err := cfg.openBatch(r.Context(), userID, batchID); err != nil {
+		respondWithError(w, http.StatusNotFound, "Batch not found", err)
 		return
 	}
 
-	// Read directory
-	entries, err := os.ReadDir(cfg.tempRoot)
+	results, err := cfg.publishBatch(r.Context(), userID, batchID, webType)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't read directory", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list batch", err)
 		return
 	}
+	// Return results
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Upload process completed",
+		"results": results,
+	})
+}
 
-	var results []UploadResult
+// publishBatch wysyła wszystkie pliki partii do WordPressa, zapisuje historię
+// i usuwa partię z poczekalni. Błędy pojedynczych plików są w wynikach.
+func (cfg *apiConfig) publishBatch(ctx context.Context, userID int, batchID string, webType WebsiteType) ([]UploadResult, error) {
+	// Pliki partii bierzemy z rejestru - tam są też ich opisy
+	assets, err := cfg.db.ListStagedAssetsByBatch(ctx, database.ListStagedAssetsByBatchParams{
+		UserID:  int64(userID),
+		BatchID: batchID,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// Upload each file
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
+	results := cfg.publishAssets(ctx, userID, assets, webType)
 
-		// Skip non-webp files (opcjonalnie)
-		if filepath.Ext(entry.Name()) != ".webp" {
-			continue
+	// Nieudane pliki trafiają do kosza, żeby dało się je przywrócić i wysłać ponownie
+	var failed []database.StagedAsset
+	for i, result := range results {
+		if !result.Success {
+			failed = append(failed, assets[i])
 		}
+	}
+	if err := cfg.trashAssets(ctx, failed); err != nil {
+		// Bez kosza partia zostaje w poczekalni - lepiej niż stracić pliki
+		log.Printf("Couldn't move failed uploads of batch %s to trash: %v", batchID, err)
+		return results, nil
+	}
+
+	//Cleanup batch folder
+	if err := cfg.removeBatch(ctx, userID, batchID); err != nil {
+		log.Printf("Couldn't remove batch %s: %v", batchID, err)
+	}
+	return results, nil
+}
 
-		filePath := filepath.Join(cfg.tempRoot, entry.Name())
+// publishAssets wysyła pliki do WordPressa po kolei i zapisuje historię.
+// Nie usuwa ich z poczekalni - to zależy od wywołującego.
+func (cfg *apiConfig) publishAssets(ctx context.Context, userID int, assets []database.StagedAsset, webType WebsiteType) []UploadResult {
+	var results []UploadResult
+
+	// Upload each file
+	for _, asset := range assets {
+		key := stagingKey(userID, asset.BatchID, asset.Filename)
 
 		// Upload to WordPress
-		mediaResp, err := cfg.uploadToWordPress(filePath, webType)
+		mediaResp, err := cfg.uploadToWordPress(ctx, key, webType)
 
 		result := UploadResult{
-			Filename: entry.Name(),
+			Filename: asset.Filename,
 		}
 
 		if err != nil {
 			result.Success = false
 			result.Error = err.Error()
-			fmt.Printf("Failed to upload %s: %v\n", entry.Name(), err)
+			fmt.Printf("Failed to upload %s: %v\n", asset.Filename, err)
 		} else {
 			result.Success = true
 			result.WordPressID = mediaResp.ID
 			result.WordPressURL = mediaResp.SourceURL
+			result.ThumbnailURL = mediaResp.ThumbnailURL()
+
+			// Plik już jest w bibliotece, więc błąd opisu nie cofa wysyłki
+			if meta := metadataFromAsset(asset); !meta.isEmpty() {
+				if err := cfg.updateWordPressMedia(mediaResp.ID, webType, meta); err != nil {
+					result.Warning = fmt.Sprintf("metadata not saved: %v", err)
+					log.Printf("Couldn't set metadata for %s: %v", asset.Filename, err)
+				}
+			}
 		}
 
-		// if result.Success {
-		// 	_, err = cfg.db.CreateUploadHistory(r.Context(), database.CreateUploadHistoryParams{
-		// 		Filename:     result.Filename,
-		// 		OriginalSize: int32(fileInfo.Size()),
-		// 		WebpSize:     int32(webpSize), // musisz to śledzić
-		// 		WordpressID:  sql.NullInt32{Int32: int32(mediaResp.ID), Valid: true},
-		// 		WordpressURL: sql.NullString{String: mediaResp.SourceURL, Valid: true},
-		// 		WebsiteType:  string(webType),
-		// 		Success:      1,
-		// 		UserID:       int32(userID), // z context
-		// 	})
-		// }
+		cfg.recordUploadHistory(ctx, asset, result, webType, userID)
 
 		results = append(results, result)
 	}
+	return results
+}
 
-	//Cleanup Temp folder
-	cfg.cleanupImages()
-	// Return results
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Upload process completed",
-		"results": results,
-	})
+// recordUploadHistory zapisuje wynik wysyłki razem z metrykami z przetwarzania
+func (cfg *apiConfig) recordUploadHistory(ctx context.Context, asset database.StagedAsset, result UploadResult, webType WebsiteType, userID int) {
+	params := database.CreateUploadHistoryParams{
+		Filename:     result.Filename,
+		OriginalSize: asset.OriginalSize,
+		WebpSize:     asset.WebpSize,
+		WebsiteType:  string(webType),
+		UserID:       int64(userID),
+		Ssim:         &asset.Ssim,
+		Quality:      &asset.Quality,
+		BatchID:      &asset.BatchID,
+	}
+	if asset.Title != "" {
+		params.Title = &asset.Title
+	}
+	if asset.AltText != "" {
+		params.AltText = &asset.AltText
+	}
+	if asset.Caption != "" {
+		params.Caption = &asset.Caption
+	}
+	if result.Success {
+		originalHash, err := cfg.retainOriginal(ctx, asset)
+		if err != nil {
+			log.Printf("Couldn't retain original of %s: %v", result.Filename, err)
+		}
+		params.OriginalHash = originalHash
+	}
+
+	if result.Success {
+		wpID := int64(result.WordPressID)
+		params.Success = 1
+		params.WordpressID = &wpID
+		params.WordpressUrl = &result.WordPressURL
+		params.ThumbnailUrl = &result.ThumbnailURL
+	} else {
+		params.ErrorMessage = &result.Error
+	}
+
+	entry, err := cfg.db.CreateUploadHistory(ctx, params)
+	if err != nil {
+		log.Printf("Couldn't save upload history for %s: %v", result.Filename, err)
+		return
+	}
+	if result.Success {
+		err := cfg.db.CopyStagedAssetTagsToUpload(ctx, database.CopyStagedAssetTagsToUploadParams{
+			UploadID: entry.ID,
+			Filename: asset.Filename,
+		})
+		if err != nil {
+			log.Printf("Couldn't copy tags of %s: %v", result.Filename, err)
+		}
+	}
 }
 
-func (cfg *apiConfig) uploadToWordPress(filePath string, webType WebsiteType) (*WPMediaResponse, error) {
-	// Select URL and password based on website type
+// wpMediaEndpoint zwraca adres endpointu /media i hasło aplikacji dla strony
+func (cfg *apiConfig) wpMediaEndpoint(webType WebsiteType) (string, string) {
 	var url, appPwd string
 
 	if webType == WebsiteTattoo {
@@ -123,11 +234,15 @@ func (cfg *apiConfig) uploadToWordPress(filePath string, webType WebsiteType) (*
 		appPwd = cfg.wpApi.threeD.threeAppPwd
 	}
 
-	// Construct full URL
-	url = fmt.Sprintf("%s%s/media", url, cfg.wpApi.baseUrl)
+	return fmt.Sprintf("%s%s/media", url, cfg.wpApi.baseUrl), appPwd
+}
+
+func (cfg *apiConfig) uploadToWordPress(ctx context.Context, key string, webType WebsiteType) (*WPMediaResponse, error) {
+	// Select URL and password based on website type
+	url, appPwd := cfg.wpMediaEndpoint(webType)
 
-	// Read file
-	file, err := os.Open(filePath)
+	// Read file from staging
+	file, _, err := cfg.staging.Get(ctx, key)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't open file: %w", err)
 	}
@@ -140,7 +255,7 @@ func (cfg *apiConfig) uploadToWordPress(filePath string, webType WebsiteType) (*
 
 	// Determine content type
 	contentType := "image/jpeg"
-	ext := filepath.Ext(filePath)
+	ext := path.Ext(key)
 	switch ext {
 	case ".png":
 		contentType = "image/png"
@@ -157,7 +272,7 @@ func (cfg *apiConfig) uploadToWordPress(filePath string, webType WebsiteType) (*
 	}
 
 	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filePath)))
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", path.Base(key)))
 	req.SetBasicAuth(cfg.wpApi.user, appPwd)
 
 	// Send request
@@ -184,25 +299,78 @@ func (cfg *apiConfig) uploadToWordPress(filePath string, webType WebsiteType) (*
 	return &mediaResponse, nil
 }
 
-func getWebsiteType(r *http.Request) (WebsiteType, error) {
+// updateWordPressMedia ustawia tytuł, alt, podpis, opis i datę istniejącego pliku w bibliotece
+func (cfg *apiConfig) updateWordPressMedia(mediaID int, webType WebsiteType, meta mediaMetadata) error {
+	url, appPwd := cfg.wpMediaEndpoint(webType)
+	url = fmt.Sprintf("%s/%d", url, mediaID)
+
+	// Puste pola pomijamy, żeby nie nadpisać tego, co WordPress ustawił sam
+	body := map[string]string{}
+	if meta.Title != "" {
+		body["title"] = meta.Title
+	}
+	if meta.AltText != "" {
+		body["alt_text"] = meta.AltText
+	}
+	if meta.Caption != "" {
+		body["caption"] = meta.Caption
+	}
+	if meta.Description != "" {
+		body["description"] = meta.Description
+	}
+	// Data bez strefy - WordPress przyjmuje ją jako czas lokalny strony
+	if meta.Date != nil {
+		body["date"] = meta.Date.Format("2006-01-02T15:04:05")
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("couldn't encode metadata: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("couldn't create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(cfg.wpApi.user, appPwd)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func getSendParams(r *http.Request) (WebsiteType, string, error) {
 	type params struct {
-		Type string `json:"type"`
+		Type  string `json:"type"`
+		Batch string `json:"batch"`
 	}
 
 	var p params
 	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
-		return "", fmt.Errorf("couldn't parse request body: %w", err)
+		return "", "", fmt.Errorf("couldn't parse request body: %w", err)
 	}
 
 	webType := WebsiteType(p.Type)
 
 	// Walidacja
 	if !webType.IsValid() {
-		return "", fmt.Errorf("invalid website type '%s' (use 'tattoo' or '3d')", p.Type)
+		return "", "", fmt.Errorf("invalid website type '%s' (use 'tattoo' or '3d')", p.Type)
+	}
+	if p.Batch == "" {
+		return "", "", fmt.Errorf("batch is required")
 	}
 
-	return webType, nil
+	return webType, p.Batch, nil
 }
 
 func (w *WPMediaResponse) GetTitle() string {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+type TagResponse struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	StagedCount    int64     `json:"stagedCount"`
+	PublishedCount int64     `json:"publishedCount"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// listTagsHandler zwraca wszystkie tagi z liczbą plików w poczekalni i w historii
+func (cfg *apiConfig) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.db.ListTags(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+	tags := make([]TagResponse, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, TagResponse{
+			ID:             row.ID,
+			Name:           row.Name,
+			StagedCount:    row.StagedCount,
+			PublishedCount: row.PublishedCount,
+			CreatedAt:      row.CreatedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"tags": tags,
+	})
+}
+
+// decodeTagsParams czyta listę tagów z ciała żądania. Przy błędzie sam odpowiada klientowi.
+func decodeTagsParams(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	type parameters struct {
+		Tags []string `json:"tags"`
+	}
+	var p parameters
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse json", err)
+		return nil, false
+	}
+	tags, err := normalizeTags(p.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return nil, false
+	}
+	return tags, true
+}
+
+// setImageTagsHandler zastępuje tagi pliku w poczekalni; pusta lista usuwa wszystkie
+func (cfg *apiConfig) setImageTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	tags, ok := decodeTagsParams(w, r)
+	if !ok {
+		return
+	}
+
+	asset, err := cfg.db.GetStagedAssetForUser(r.Context(), database.GetStagedAssetForUserParams{
+		Filename: r.PathValue("filename"),
+		UserID:   int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "File not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get staged image", err)
+		}
+		return
+	}
+	if err := cfg.setStagedAssetTags(r.Context(), asset.Filename, tags); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stagedImage(r.Context(), asset))
+}
+
+// deleteTagHandler usuwa tag ze wszystkich plików (tylko admin - tagi są wspólne)
+func (cfg *apiConfig) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag ID", err)
+		return
+	}
+	if _, err := cfg.db.GetTag(r.Context(), tagID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Tag not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get tag", err)
+		}
+		return
+	}
+	if err := cfg.db.DeleteTag(r.Context(), tagID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete tag", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
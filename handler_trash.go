@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/google/uuid"
+)
+
+type TrashedImage struct {
+	StagedImage
+	DeletedAt time.Time  `json:"deletedAt"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+// listTrashHandler zwraca pliki użytkownika leżące w koszu, od ostatnio usuniętych
+func (cfg *apiConfig) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	assets, err := cfg.db.ListTrashedAssetsByUser(r.Context(), int64(userID))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list trash", err)
+		return
+	}
+
+	tags, err := cfg.stagedTagsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tags", err)
+		return
+	}
+
+	images := make([]TrashedImage, 0, len(assets))
+	for _, asset := range assets {
+		image := cfg.trashedImageFromRow(asset)
+		if assetTags, ok := tags[asset.Filename]; ok {
+			image.Tags = assetTags
+		}
+		images = append(images, image)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"images":    images,
+		"retention": cfg.janitor.trashRetention.String(),
+	})
+}
+
+// restoreImageHandler przywraca plik z kosza do poczekalni. Limitu nie sprawdzamy -
+// plik w koszu cały czas się do niego liczy.
+func (cfg *apiConfig) restoreImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+	filename := r.PathValue("filename")
+	if filename == "" {
+		respondWithError(w, http.StatusBadRequest, "No filename provided", nil)
+		return
+	}
+
+	asset, err := cfg.db.GetTrashedAssetForUser(r.Context(), database.GetTrashedAssetForUserParams{
+		Filename: filename,
+		UserID:   int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "File not found in trash", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find file", err)
+		}
+		return
+	}
+	restored, err := cfg.restoreStagedAsset(r.Context(), asset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore file", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stagedImage(r.Context(), restored))
+}
+
+// trashFileHandler serwuje podgląd pliku z kosza - walidacja jak w stagingFileHandler,
+// ale partia mogła już zniknąć, więc sprawdzamy tylko format jej identyfikatora
+func (cfg *apiConfig) trashFileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	batchID := r.PathValue("batchID")
+	filename := r.PathValue("filename")
+	if err != nil || filepath.Ext(filename) != ".webp" || filename != filepath.Base(filename) {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := uuid.Parse(batchID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	serveObject(w, r, cfg.staging, trashKey(userID, batchID, filename))
+}
+
+func (cfg *apiConfig) trashedImageFromRow(asset database.StagedAsset) TrashedImage {
+	image := TrashedImage{StagedImage: stagedImageFromRow(asset)}
+	image.PreviewURL = trashURL(int(asset.UserID), asset.BatchID, asset.Filename)
+	if asset.DeletedAt != nil {
+		image.DeletedAt = *asset.DeletedAt
+		if cfg.janitor.trashRetention > 0 {
+			purgeAt := asset.DeletedAt.Add(cfg.janitor.trashRetention)
+			image.PurgeAt = &purgeAt
+		}
+	}
+	return image
+}
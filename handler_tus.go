@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/google/uuid"
+)
+
+// Wznawialne uploady zgodne z tus 1.0.0 (rozszerzenia creation, expiration, termination).
+// Po odebraniu ostatniego bajtu plik trafia do tego samego przetwarzania co upload multipart,
+// a wynik można odczytać przez GET /api/uploads/{id}.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusMaxSize    = 1 << 30 // 1 GB, tyle samo co upload multipart
+
+	// Niedokończony upload wygasa po dobie bez aktywności
+	tusUploadExpiry      = 24 * time.Hour
+	tusJanitorInterval   = 15 * time.Minute
+	tusOffsetContentType = "application/offset+octet-stream"
+)
+
+// uploadLocks pilnuje, żeby do jednego uploadu nie pisały równolegle dwa żądania PATCH
+type uploadLocks struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func newUploadLocks() *uploadLocks {
+	return &uploadLocks{held: map[string]bool{}}
+}
+
+func (l *uploadLocks) tryLock(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[id] {
+		return false
+	}
+	l.held[id] = true
+	return true
+}
+
+func (l *uploadLocks) unlock(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.held, id)
+}
+
+type UploadStatus struct {
+	ID          string     `json:"id"`
+	Filename    string     `json:"filename"`
+	Length      int64      `json:"length"`
+	Offset      int64      `json:"offset"`
+	BatchID     string     `json:"batchId"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Image       string     `json:"image,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func (cfg *apiConfig) uploadsDir() string {
+	return filepath.Join(cfg.tempRoot, "uploads")
+}
+
+func (cfg *apiConfig) uploadPath(id string) string {
+	return filepath.Join(cfg.uploadsDir(), id)
+}
+
+// tusMiddleware dokleja nagłówek Tus-Resumable i odrzuca klientów w innej wersji protokołu
+func tusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Method != http.MethodGet && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) tusOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(tusMaxSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusCreateHandler zakłada upload. Ustawienia przetwarzania przychodzą w Upload-Metadata:
+// filename, filetype, preset, destination, batch, title, autoQuality.
+func (cfg *apiConfig) tusCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	if length > tusMaxSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large", nil)
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	filename := filepath.Base(meta["filename"])
+	if meta["filename"] == "" {
+		respondWithError(w, http.StatusBadRequest, "Upload-Metadata must contain filename", nil)
+		return
+	}
+	autoQuality, _ := strconv.ParseBool(meta["autoQuality"])
+	settings := uploadSettings{
+		Preset:      meta["preset"],
+		Destination: meta["destination"],
+		Title:       meta["title"],
+		AutoQuality: autoQuality,
+	}
+
+	// Typ i ustawienia sprawdzamy od razu, a nie po przesłaniu 200 MB
+	source := imageSource{Name: filename, Size: length, ContentType: meta["filetype"]}
+	if _, err := validateImageType(source); err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, err.Error(), err)
+		return
+	}
+	if _, _, err := cfg.resolvePipeline(r.Context(), settings.Preset, settings.Destination, settings.AutoQuality); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if !cfg.enforceQuota(w, r, userID, 1, length) {
+		return
+	}
+	batchID, ok := cfg.resolveBatchOrRespond(w, r, userID, meta["batch"])
+	if !ok {
+		return
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't encode settings", err)
+		return
+	}
+	if err := os.MkdirAll(cfg.uploadsDir(), 0755); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create uploads directory", err)
+		return
+	}
+	id := uuid.New().String()
+	if err := os.WriteFile(cfg.uploadPath(id), nil, 0644); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload file", err)
+		return
+	}
+
+	upload, err := cfg.db.CreateUpload(r.Context(), database.CreateUploadParams{
+		ID:          id,
+		UserID:      int64(userID),
+		Filename:    filename,
+		ContentType: meta["filetype"],
+		Length:      length,
+		Settings:    string(settingsJSON),
+		BatchID:     batchID,
+		ExpiresAt:   time.Now().UTC().Add(tusUploadExpiry),
+	})
+	if err != nil {
+		os.Remove(cfg.uploadPath(id))
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+id)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) tusHeadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.uploadFromRequest(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// tusPatchHandler dopisuje kolejny fragment od Upload-Offset. Zapisany zostaje każdy
+// odebrany bajt - przerwane połączenie można wznowić od miejsca, w którym się urwało.
+func (cfg *apiConfig) tusPatchHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.uploadFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusOffsetContentType, nil)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusConflict, "Upload-Offset does not match", err)
+		return
+	}
+	if !cfg.uploadLocks.tryLock(upload.ID) {
+		respondWithError(w, http.StatusConflict, "Upload is in use by another request", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(upload.ID)
+
+	// Stan sprawdzamy dopiero pod blokadą - poprzednie żądanie mogło w międzyczasie
+	// przesunąć offset, a Truncate na starym offsecie zniszczyłby zapisane bajty
+	upload, err = cfg.db.GetUploadForUser(r.Context(), database.GetUploadForUserParams{
+		ID:     upload.ID,
+		UserID: upload.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	if offset != upload.UploadOffset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset does not match", nil)
+		return
+	}
+	if upload.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload is already complete", nil)
+		return
+	}
+
+	file, err := os.OpenFile(cfg.uploadPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload file", err)
+		return
+	}
+	// Po przerwanym żądaniu plik może mieć więcej bajtów niż zapisany offset
+	if err := file.Truncate(offset); err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare upload file", err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, upload.Length-offset)
+	written, copyErr := io.Copy(file, body)
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	upload, err = cfg.db.AdvanceUploadOffset(r.Context(), database.AdvanceUploadOffsetParams{
+		UploadOffset:   offset + written,
+		ExpiresAt:      time.Now().UTC().Add(tusUploadExpiry),
+		ID:             upload.ID,
+		UploadOffset_2: offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload offset", err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if copyErr != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload interrupted", copyErr)
+		return
+	}
+
+	if upload.UploadOffset == upload.Length {
+		// Dane są już kompletne, więc rozłączenie klienta nie może przerwać przetwarzania -
+		// plik roboczy i tak znika, a upload zostałby na zawsze niedokończony
+		cfg.finishUpload(context.WithoutCancel(r.Context()), upload)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) tusDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.uploadFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.uploadLocks.tryLock(upload.ID) {
+		respondWithError(w, http.StatusConflict, "Upload is in use by another request", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(upload.ID)
+
+	if err := cfg.removeUpload(r.Context(), upload.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadStatusHandler to rozszerzenie spoza tus - wynik przetwarzania zakończonego uploadu
+func (cfg *apiConfig) uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.uploadFromRequest(w, r)
+	if !ok {
+		return
+	}
+	status := UploadStatus{
+		ID:          upload.ID,
+		Filename:    upload.Filename,
+		Length:      upload.Length,
+		Offset:      upload.UploadOffset,
+		BatchID:     upload.BatchID,
+		ExpiresAt:   upload.ExpiresAt,
+		CompletedAt: upload.CompletedAt,
+	}
+	if upload.ResultFilename != nil {
+		status.Image = *upload.ResultFilename
+	}
+	if upload.Error != nil {
+		status.Error = *upload.Error
+	}
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+func (cfg *apiConfig) uploadFromRequest(w http.ResponseWriter, r *http.Request) (database.Upload, bool) {
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return database.Upload{}, false
+	}
+	upload, err := cfg.db.GetUploadForUser(r.Context(), database.GetUploadForUserParams{
+		ID:     r.PathValue("id"),
+		UserID: int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		}
+		return database.Upload{}, false
+	}
+	if upload.CompletedAt == nil && time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusGone, "Upload expired", nil)
+		return database.Upload{}, false
+	}
+	return upload, true
+}
+
+// finishUpload przetwarza kompletny plik i zapisuje wynik przy uploadzie.
+// Błąd przetwarzania nie jest błędem protokołu - klient odczyta go z GET /api/uploads/{id}.
+func (cfg *apiConfig) finishUpload(ctx context.Context, upload database.Upload) {
+	path := cfg.uploadPath(upload.ID)
+	defer os.Remove(path)
+
+	var result database.CompleteUploadParams
+	result.ID = upload.ID
+
+	info, err := cfg.processUpload(ctx, upload, path)
+	if err != nil {
+		msg := err.Error()
+		result.Error = &msg
+		log.Printf("Couldn't process upload %s: %v", upload.ID, err)
+	} else {
+		result.ResultFilename = &info.Filename
+	}
+	if err := cfg.db.CompleteUpload(ctx, result); err != nil {
+		log.Printf("Couldn't complete upload %s: %v", upload.ID, err)
+	}
+}
+
+func (cfg *apiConfig) processUpload(ctx context.Context, upload database.Upload, path string) (ImageInfo, error) {
+	var settings uploadSettings
+	if err := json.Unmarshal([]byte(upload.Settings), &settings); err != nil {
+		return ImageInfo{}, fmt.Errorf("couldn't parse upload settings: %w", err)
+	}
+	userID := int(upload.UserID)
+	// Partia mogła zostać wysłana albo posprzątana w trakcie uploadu
+	if err := cfg.openBatch(ctx, userID, upload.BatchID); err != nil {
+		return ImageInfo{}, err
+	}
+	opts, err := cfg.processOptionsFor(ctx, userID, upload.BatchID, settings)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return cfg.processImage(ctx, imageSource{
+		Name:        upload.Filename,
+		Size:        upload.Length,
+		ContentType: upload.ContentType,
+		open: func() (multipart.File, error) {
+			return os.Open(path)
+		},
+	}, opts)
+}
+
+func (cfg *apiConfig) removeUpload(ctx context.Context, id string) error {
+	if err := os.Remove(cfg.uploadPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return cfg.db.DeleteUpload(ctx, id)
+}
+
+// parseTusMetadata dekoduje nagłówek Upload-Metadata: "klucz base64,klucz2 base64"
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if header == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// startUploadJanitor co jakiś czas usuwa wygasłe uploady (dane i wpisy w bazie)
+func (cfg *apiConfig) startUploadJanitor(ctx context.Context) {
+	ticker := time.NewTicker(tusJanitorInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cfg.expireUploads(ctx)
+			}
+		}
+	}()
+}
+
+func (cfg *apiConfig) expireUploads(ctx context.Context) {
+	expired, err := cfg.db.ListExpiredUploads(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("Couldn't list expired uploads: %v", err)
+		return
+	}
+	for _, upload := range expired {
+		if !cfg.uploadLocks.tryLock(upload.ID) {
+			continue
+		}
+		if err := cfg.removeUpload(ctx, upload.ID); err != nil {
+			log.Printf("Couldn't remove expired upload %s: %v", upload.ID, err)
+		} else if upload.CompletedAt == nil {
+			log.Printf("Usunięto niedokończony upload %s (%s, %d/%d bajtów)", upload.ID, upload.Filename, upload.UploadOffset, upload.Length)
+		}
+		cfg.uploadLocks.unlock(upload.ID)
+	}
+}
@@ -1,39 +1,83 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
 	_ "image/jpeg" // Ważne! Zarejestruj dekodery
 	_ "image/png"
+	"io"
 	"log"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
 	"github.com/chai2010/webp"
-	"github.com/google/uuid"
 	"github.com/jdeng/goheif"
-	"github.com/nfnt/resize"
 )
 
 type Images struct {
-	Images []ImageInfo `json:"images"`
+	BatchID string      `json:"batchId"`
+	Images  []ImageInfo `json:"images"`
 }
 
 type ImageInfo struct {
-	OriginalSize int    `json:"originalSize"`
-	WebpSize     int    `json:"webpSize"`
-	Filename     string `json:"filename"`
+	OriginalSize int        `json:"originalSize"`
+	WebpSize     int        `json:"webpSize"`
+	Filename     string     `json:"filename"`
+	SSIM         float64    `json:"ssim"`
+	Quality      float32    `json:"quality"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	PreviewURL   string     `json:"previewUrl"`
+	Title        string     `json:"title"`
+	Caption      string     `json:"caption"`
+	CapturedAt   *time.Time `json:"capturedAt,omitempty"`
+	CameraModel  string     `json:"cameraModel,omitempty"`
+	Keywords     []string   `json:"keywords"`
+}
+
+// processOptions opisuje, jak i dokąd przetworzyć pliki z jednego żądania
+type processOptions struct {
+	pipeline    compiledPipeline
+	preset      string
+	autoQuality bool
+	site        string
+	title       string
+	userID      int
+	batchID     string
+}
+
+// imageSource to plik do przetworzenia niezależnie od tego, skąd przyszedł
+// (pole formularza, wpis archiwum ZIP, ...)
+type imageSource struct {
+	Name        string
+	Size        int64
+	ContentType string
+	open        func() (multipart.File, error)
+}
+
+func sourceFromFileHeader(fileHeader *multipart.FileHeader) imageSource {
+	return imageSource{
+		Name:        fileHeader.Filename,
+		Size:        fileHeader.Size,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		open:        fileHeader.Open,
+	}
 }
 
 // Job reprezentuje jedno zadanie do przetworzenia
 type Job struct {
-	FileHeader *multipart.FileHeader
-	Index      int
+	Source imageSource
+	Index  int
 }
 
 // Result reprezentuje wynik przetworzenia
@@ -43,13 +87,20 @@ type Result struct {
 	Index     int
 }
 
+const numWorkers = 4 // Liczba równoczesnych przetwarzań
+
 // Główny handler
 func (cfg *apiConfig) uploadImagesHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Endpoint hitted\n")
 	startTime := time.Now()
 
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
 	const uploadLimit = 1 << 30 // 1 GB
-	const numWorkers = 4        // Liczba równoczesnych przetwarzań
 
 	r.Body = http.MaxBytesReader(w, r.Body, uploadLimit)
 	err := r.ParseMultipartForm(uploadLimit)
@@ -64,11 +115,156 @@ func (cfg *apiConfig) uploadImagesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	log.Printf("Przetwarzam %d plików używając %d workerów...\n", len(files), numWorkers)
+	var incoming int64
+	for _, fileHeader := range files {
+		incoming += fileHeader.Size
+	}
+	if !cfg.enforceQuota(w, r, userID, len(files), incoming) {
+		return
+	}
+
+	opts, ok := cfg.processOptionsFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	sources := make([]imageSource, len(files))
+	for i, fileHeader := range files {
+		sources[i] = sourceFromFileHeader(fileHeader)
+	}
+	resultSlice := cfg.processSources(r.Context(), sources, opts)
+
+	// Sprawdź błędy i zbuduj odpowiedź
+	var finalResults []ImageInfo
+	for _, result := range resultSlice {
+		if result.Error != nil {
+			respondWithError(w, http.StatusBadRequest, result.Error.Error(), result.Error)
+			return
+		}
+		finalResults = append(finalResults, result.ImageInfo)
+	}
+
+	elapsed := time.Since(startTime)
+	log.Printf("✓ Przetworzono %d plików w %v (%.2f plików/s)\n",
+		len(files), elapsed, float64(len(files))/elapsed.Seconds())
+
+	response := Images{BatchID: opts.batchID, Images: finalResults}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// uploadSettings to ustawienia przetwarzania podane przez klienta
+// (pola formularza albo metadane uploadu tus)
+type uploadSettings struct {
+	Preset      string `json:"preset,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Title       string `json:"title,omitempty"`
+	AutoQuality bool   `json:"autoQuality,omitempty"`
+}
+
+func uploadSettingsFromForm(r *http.Request) uploadSettings {
+	autoQuality, _ := strconv.ParseBool(r.FormValue("autoQuality"))
+	return uploadSettings{
+		Preset:      r.FormValue("preset"),
+		Destination: r.FormValue("destination"),
+		Title:       r.FormValue("title"),
+		AutoQuality: autoQuality,
+	}
+}
+
+// processOptionsFromRequest czyta preset, destynację i partię z formularza.
+// Przy błędzie sam odpowiada klientowi i zwraca false.
+func (cfg *apiConfig) processOptionsFromRequest(w http.ResponseWriter, r *http.Request, userID int) (processOptions, bool) {
+	settings := uploadSettingsFromForm(r)
+	// Walidacja przed założeniem partii, żeby błędny preset nie zostawiał pustych katalogów
+	if _, _, err := cfg.resolvePipeline(r.Context(), settings.Preset, settings.Destination, settings.AutoQuality); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return processOptions{}, false
+	}
+
+	batchID, ok := cfg.resolveBatchOrRespond(w, r, userID, r.FormValue("batch"))
+	if !ok {
+		return processOptions{}, false
+	}
+	opts, err := cfg.processOptionsFor(r.Context(), userID, batchID, settings)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return processOptions{}, false
+	}
+	return opts, true
+}
+
+// resolveBatch otwiera wskazaną partię albo zakłada nową, gdy ID jest puste.
+// Zwraca też status HTTP odpowiedni dla błędu.
+func (cfg *apiConfig) resolveBatch(ctx context.Context, userID int, batchID string) (string, int, error) {
+	if batchID == "" {
+		batchID, err := cfg.createBatch(ctx, userID)
+		if err != nil {
+			return "", http.StatusInternalServerError, err
+		}
+		return batchID, http.StatusOK, nil
+	}
+	if err := cfg.openBatch(ctx, userID, batchID); err != nil {
+		return "", http.StatusNotFound, err
+	}
+	return batchID, http.StatusOK, nil
+}
+
+// resolveBatchOrRespond wywołuje resolveBatch i przy błędzie sam odpowiada klientowi.
+// Zwraca false, gdy handler powinien zakończyć obsługę.
+func (cfg *apiConfig) resolveBatchOrRespond(w http.ResponseWriter, r *http.Request, userID int, batchID string) (string, bool) {
+	batchID, status, err := cfg.resolveBatch(r.Context(), userID, batchID)
+	if err != nil {
+		msg := "Couldn't create batch"
+		if status == http.StatusNotFound {
+			msg = "Batch not found"
+		}
+		respondWithError(w, status, msg, err)
+		return "", false
+	}
+	return batchID, true
+}
+
+// processOptionsFor buduje opcje przetwarzania dla istniejącej partii
+func (cfg *apiConfig) processOptionsFor(ctx context.Context, userID int, batchID string, settings uploadSettings) (processOptions, error) {
+	preset, pipeline, err := cfg.resolvePipeline(ctx, settings.Preset, settings.Destination, settings.AutoQuality)
+	if err != nil {
+		return processOptions{}, err
+	}
+	return processOptions{
+		pipeline:    pipeline,
+		preset:      preset.Name,
+		autoQuality: settings.AutoQuality,
+		site:        settings.Destination,
+		title:       settings.Title,
+		userID:      userID,
+		batchID:     batchID,
+	}, nil
+}
+
+// resolvePipeline łączy preset, destynację i autoQuality w gotowy potok
+func (cfg *apiConfig) resolvePipeline(ctx context.Context, presetName, destination string, autoQuality bool) (imagePreset, compiledPipeline, error) {
+	preset, err := getPreset(presetName)
+	if err != nil {
+		return imagePreset{}, compiledPipeline{}, err
+	}
+	// Bez autoQuality próg SSIM z presetu nie obowiązuje
+	if !autoQuality {
+		preset.MinSSIM = 0
+	}
+	pipeline, err := cfg.pipelineFor(ctx, destination, preset)
+	if err != nil {
+		return imagePreset{}, compiledPipeline{}, err
+	}
+	return preset, pipeline, nil
+}
+
+// processSources przetwarza pliki pulą workerów i zwraca wyniki w kolejności wejścia
+func (cfg *apiConfig) processSources(ctx context.Context, sources []imageSource, opts processOptions) []Result {
+	log.Printf("Przetwarzam %d plików używając %d workerów...\n", len(sources), numWorkers)
 
 	// Kanały do komunikacji
-	jobs := make(chan Job, len(files))
-	results := make(chan Result, len(files))
+	jobs := make(chan Job, len(sources))
+	results := make(chan Result, len(sources))
 
 	// WaitGroup do czekania na zakończenie wszystkich workerów
 	var wg sync.WaitGroup
@@ -79,9 +275,9 @@ func (cfg *apiConfig) uploadImagesHandler(w http.ResponseWriter, r *http.Request
 		go func(workerID int) {
 			defer wg.Done()
 			for job := range jobs {
-				log.Printf("[Worker %d] Przetwarzam %s...\n", workerID, job.FileHeader.Filename)
+				log.Printf("[Worker %d] Przetwarzam %s...\n", workerID, job.Source.Name)
 
-				imageInfo, err := cfg.processImage(job.FileHeader)
+				imageInfo, err := cfg.processImage(ctx, job.Source, opts)
 				results <- Result{
 					ImageInfo: imageInfo,
 					Error:     err,
@@ -93,10 +289,10 @@ func (cfg *apiConfig) uploadImagesHandler(w http.ResponseWriter, r *http.Request
 
 	// Wyślij zadania do workerów
 	go func() {
-		for i, fileHeader := range files {
+		for i, source := range sources {
 			jobs <- Job{
-				FileHeader: fileHeader,
-				Index:      i,
+				Source: source,
+				Index:  i,
 			}
 		}
 		close(jobs) // Zamknij kanał gdy wszystkie zadania wysłane
@@ -109,95 +305,288 @@ func (cfg *apiConfig) uploadImagesHandler(w http.ResponseWriter, r *http.Request
 	}()
 
 	// Zbierz wyniki (zachowaj oryginalną kolejność)
-	resultSlice := make([]Result, len(files))
+	resultSlice := make([]Result, len(sources))
 	for result := range results {
 		resultSlice[result.Index] = result
 	}
-
-	// Sprawdź błędy i zbuduj odpowiedź
-	var finalResults []ImageInfo
-	for _, result := range resultSlice {
-		if result.Error != nil {
-			respondWithError(w, http.StatusBadRequest, result.Error.Error(), result.Error)
-			return
-		}
-		finalResults = append(finalResults, result.ImageInfo)
-	}
-
-	elapsed := time.Since(startTime)
-	log.Printf("✓ Przetworzono %d plików w %v (%.2f plików/s)\n",
-		len(files), elapsed, float64(len(files))/elapsed.Seconds())
-
-	response := Images{Images: finalResults}
-	respondWithJSON(w, http.StatusOK, response)
+	return resultSlice
 }
 
 // Przetwarzanie pojedynczego obrazu
-func (cfg *apiConfig) processImage(fileHeader *multipart.FileHeader) (ImageInfo, error) {
+func (cfg *apiConfig) processImage(ctx context.Context, source imageSource, opts processOptions) (ImageInfo, error) {
 	start := time.Now()
 	defer func() {
-		log.Printf("Przetworzono %s w %v\n", fileHeader.Filename, time.Since(start))
+		log.Printf("Przetworzono %s w %v\n", source.Name, time.Since(start))
 	}()
 
-	const maxWidth = 2560
-	const maxHeight = 1440
-
 	log.Printf("1. Walidacja typu...")
-	mediaType, err := validateImageType(fileHeader)
+	mediaType, err := validateImageType(source)
 	if err != nil {
 		return ImageInfo{}, err
 	}
 	log.Printf("   Typ: %s (czas: %v)\n", mediaType, time.Since(start))
 
 	log.Printf("2. Otwieranie pliku...")
-	file, err := fileHeader.Open()
+	file, err := source.open()
 	if err != nil {
 		return ImageInfo{}, fmt.Errorf("couldn't open file: %w", err)
 	}
 	defer file.Close()
 	log.Printf("   Otwarto (czas: %v)\n", time.Since(start))
 
-	originalSize := fileHeader.Size
+	originalSize := source.Size
+	// Docelowa nazwa zależy od wymiarów wyniku, więc najpierw zapisujemy pod nazwą roboczą
+	workPath := cfg.scratchPath()
+	defer os.Remove(workPath)
+	pipeline := opts.pipeline
 
-	log.Printf("3. Dekodowanie i resize...")
-	decodeStart := time.Now()
-	img, err := decodeAndResize(file, maxWidth, maxHeight, mediaType)
+	sourceHash, err := hashSource(file)
 	if err != nil {
 		return ImageInfo{}, err
 	}
-	log.Printf("   Dekodowanie zajęło: %v\n", time.Since(decodeStart))
+	cacheKey := cfg.cache.key(sourceHash, pipeline.fingerprint)
+	cached, hit, err := cfg.cache.get(cacheKey, workPath)
+	if err != nil {
+		log.Printf("   Cache: %v", err)
+	}
+
+	// Metadane czytamy zawsze - wpis w cache ma tylko wynik kodowania
+	capture := readCaptureMetadata(file, mediaType)
+	info := ImageInfo{
+		OriginalSize: int(originalSize),
+		Title:        truncateRunes(firstNonEmpty(strings.TrimSpace(opts.title), capture.Title), maxTitleLength),
+		Caption:      truncateRunes(capture.Caption, maxCaptionLength),
+		CapturedAt:   capture.CapturedAt,
+		CameraModel:  capture.CameraModel,
+		Keywords:     capture.Keywords,
+	}
+	if info.Keywords == nil {
+		info.Keywords = []string{}
+	}
+	if hit {
+		fileInfo, err := os.Stat(workPath)
+		if err != nil {
+			return ImageInfo{}, fmt.Errorf("couldn't stat WebP file: %w", err)
+		}
+		log.Printf("   Trafienie w cache (czas: %v)\n", time.Since(start))
+		info.WebpSize = int(fileInfo.Size())
+		info.SSIM = cached.SSIM
+		info.Quality = cached.Quality
+	} else {
+		log.Printf("3. Dekodowanie...")
+		decodeStart := time.Now()
+		meta := sourceMeta{Orientation: exifOrientation(file, mediaType)}
+		img, err := decodeImage(file, mediaType)
+		if err != nil {
+			return ImageInfo{}, err
+		}
+		log.Printf("   Dekodowanie zajęło: %v\n", time.Since(decodeStart))
+
+		log.Printf("4. Kroki potoku...")
+		pipelineStart := time.Now()
+		img, err = pipeline.run(img, meta)
+		if err != nil {
+			return ImageInfo{}, err
+		}
+		log.Printf("   Potok zajął: %v\n", time.Since(pipelineStart))
+
+		log.Printf("5. Zapisywanie jako WebP...")
+		encodeStart := time.Now()
+		webpSize, metrics, err := cfg.encodeWithMetrics(img, workPath, pipeline.encode)
+		if err != nil {
+			return ImageInfo{}, err
+		}
+		log.Printf("   Encoding WebP zajął: %v (jakość %.0f, SSIM %.4f)\n", time.Since(encodeStart), metrics.Quality, metrics.SSIM)
+
+		if err := cfg.cache.put(cacheKey, workPath, metrics); err != nil {
+			log.Printf("   Cache: %v", err)
+		}
+		info.WebpSize = int(webpSize)
+		info.SSIM = metrics.SSIM
+		info.Quality = metrics.Quality
+	}
 
-	log.Printf("4. Zapisywanie jako WebP...")
-	encodeStart := time.Now()
-	filename := fmt.Sprintf("%s.webp", uuid.New().String())
-	webpSize, err := cfg.saveAsWebP(img, filename)
+	info.Width, info.Height, err = webpDimensions(workPath)
 	if err != nil {
 		return ImageInfo{}, err
 	}
-	log.Printf("   Encoding WebP zajął: %v\n", time.Since(encodeStart))
 
-	return ImageInfo{
-		OriginalSize: int(originalSize),
-		WebpSize:     int(webpSize),
-		Filename:     filename,
-	}, nil
+	base := renderFilename(cfg.filenameTemplate, filenameFields{
+		Site:   opts.site,
+		Slug:   slugSource(opts.title, source.Name),
+		Width:  info.Width,
+		Height: info.Height,
+		Preset: opts.preset,
+	})
+	filename, err := cfg.reserveFilename(ctx, base)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	defer cfg.releaseFilename(filename)
+	outputKey := stagingKey(opts.userID, opts.batchID, filename)
+	if err := cfg.putStagedFile(ctx, outputKey, workPath); err != nil {
+		return ImageInfo{}, err
+	}
+	info.Filename = filename
+	info.PreviewURL = stagingURL(opts.userID, opts.batchID, filename)
+
+	originalFile, err := cfg.keepOriginal(ctx, file, originalSize, opts.userID, opts.batchID, filename, source.Name)
+	if err != nil {
+		cfg.staging.Delete(ctx, outputKey)
+		return ImageInfo{}, err
+	}
+
+	_, err = cfg.db.CreateStagedAsset(ctx, database.CreateStagedAssetParams{
+		Filename:     info.Filename,
+		BatchID:      opts.batchID,
+		UserID:       int64(opts.userID),
+		OriginalName: source.Name,
+		OriginalSize: int64(info.OriginalSize),
+		WebpSize:     int64(info.WebpSize),
+		Width:        int64(info.Width),
+		Height:       int64(info.Height),
+		Preset:       opts.preset,
+		Title:        info.Title,
+		Caption:      info.Caption,
+		Ssim:         info.SSIM,
+		Quality:      float64(info.Quality),
+		MediaType:    mediaType,
+		OriginalFile: originalFile,
+		Destination:  opts.site,
+		AutoQuality:  boolToInt64(opts.autoQuality),
+		SourceHash:   sourceHash,
+		CapturedAt:   info.CapturedAt,
+		CameraModel:  info.CameraModel,
+		Keywords:     encodeKeywords(info.Keywords),
+	})
+	if err != nil {
+		cfg.staging.Delete(ctx, outputKey)
+		cfg.staging.Delete(ctx, stagingKey(opts.userID, opts.batchID, originalFile))
+		return ImageInfo{}, fmt.Errorf("couldn't record staged image: %w", err)
+	}
+
+	return info, nil
+}
+
+// Krok podnoszenia jakości i jej górna granica przy autoQuality
+const (
+	autoQualityStep = 5
+	maxAutoQuality  = 95
+)
+
+// encodeWithMetrics zapisuje WebP i mierzy SSIM względem obrazu przed kodowaniem.
+// Gdy ustawiono próg MinSSIM, koduje ponownie z wyższą jakością aż go osiągnie.
+func (cfg *apiConfig) encodeWithMetrics(img image.Image, outputPath string, params encodeParams) (int64, cacheMeta, error) {
+	for {
+		webpSize, err := cfg.saveAsWebP(img, outputPath, params)
+		if err != nil {
+			return 0, cacheMeta{}, err
+		}
+		ssim := 1.0
+		if !params.Lossless {
+			ssim, err = measureWebP(img, outputPath)
+			if err != nil {
+				os.Remove(outputPath)
+				return 0, cacheMeta{}, fmt.Errorf("couldn't measure quality: %w", err)
+			}
+		}
+		metrics := cacheMeta{SSIM: ssim, Quality: params.Quality}
+
+		if params.MinSSIM == 0 || ssim >= params.MinSSIM || params.Quality >= maxAutoQuality {
+			return webpSize, metrics, nil
+		}
+		log.Printf("   SSIM %.4f < %.4f przy jakości %.0f - podnoszę jakość", ssim, params.MinSSIM, params.Quality)
+		params.Quality = min(params.Quality+autoQualityStep, maxAutoQuality)
+	}
+}
+
+const (
+	mediaTypePSD       = "image/vnd.adobe.photoshop"
+	mediaTypeProcreate = "application/x-procreate"
+	mediaTypeDNG       = "image/x-adobe-dng"
+	mediaTypeCR2       = "image/x-canon-cr2"
+	mediaTypeNEF       = "image/x-nikon-nef"
+)
+
+// Alternatywne nazwy typów MIME zgłaszane przez różne systemy
+var mediaTypeAliases = map[string]string{
+	"image/x-photoshop":       mediaTypePSD,
+	"image/psd":               mediaTypePSD,
+	"application/x-photoshop": mediaTypePSD,
+	"application/photoshop":   mediaTypePSD,
+	"application/psd":         mediaTypePSD,
+	"image/dng":               mediaTypeDNG,
+	"image/x-dng":             mediaTypeDNG,
+	"image/cr2":               mediaTypeCR2,
+	"image/nef":               mediaTypeNEF,
+}
+
+// Przeglądarki nie znają typów plików z programów graficznych i wysyłają
+// application/octet-stream, a wpisy archiwów ZIP nie mają typu wcale -
+// wtedy typ ustalamy po rozszerzeniu
+var extensionMediaTypes = map[string]string{
+	".jpg":       "image/jpeg",
+	".jpeg":      "image/jpeg",
+	".png":       "image/png",
+	".webp":      "image/webp",
+	".heic":      "image/heic",
+	".heif":      "image/heif",
+	".psd":       mediaTypePSD,
+	".psb":       mediaTypePSD,
+	".procreate": mediaTypeProcreate,
+	".dng":       mediaTypeDNG,
+	".cr2":       mediaTypeCR2,
+	".nef":       mediaTypeNEF,
+}
+
+// mediaTypeExtension zwraca rozszerzenie dla typu obrazu (np. do nazwy oryginału)
+func mediaTypeExtension(mediaType string) string {
+	switch mediaType {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case mediaTypePSD:
+		return ".psd"
+	}
+	for ext, t := range extensionMediaTypes {
+		if t == mediaType {
+			return ext
+		}
+	}
+	return ""
 }
 
 // Walidacja typu pliku
-func validateImageType(fileHeader *multipart.FileHeader) (string, error) {
-	contentType := fileHeader.Header.Get("Content-Type")
+func validateImageType(source imageSource) (string, error) {
+	contentType := source.ContentType
 	mediaType, _, err := mime.ParseMediaType(contentType)
-	if err != nil {
+	if err != nil && contentType != "" {
 		return "", fmt.Errorf("couldn't parse media type: %w", err)
 	}
+	if alias, ok := mediaTypeAliases[mediaType]; ok {
+		mediaType = alias
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		ext := strings.ToLower(filepath.Ext(source.Name))
+		if byExt, ok := extensionMediaTypes[ext]; ok {
+			mediaType = byExt
+		}
+	}
+	if mediaType == "" {
+		return "", fmt.Errorf("couldn't determine media type of %s", source.Name)
+	}
 
 	validTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/webp": true,
-		"image/heic": true,
-		"image/heif": true,
+		"image/jpeg":       true,
+		"image/jpg":        true,
+		"image/png":        true,
+		"image/webp":       true,
+		"image/heic":       true,
+		"image/heif":       true,
+		mediaTypePSD:       true,
+		mediaTypeProcreate: true,
+		mediaTypeDNG:       true,
+		mediaTypeCR2:       true,
+		mediaTypeNEF:       true,
 	}
 
 	if !validTypes[mediaType] {
@@ -207,40 +596,60 @@ func validateImageType(fileHeader *multipart.FileHeader) (string, error) {
 	return mediaType, nil
 }
 
-// Dekodowanie i resize obrazu
-func decodeAndResize(file multipart.File, maxWidth, maxHeight uint, mediaType string) (image.Image, error) {
-	// Dekoduj
-	var img image.Image
-	var err error
-
-	if mediaType == "image/heic" || mediaType == "image/heif" {
-		img, err = goheif.Decode(file)
+// Dekodowanie obrazu
+func decodeImage(file io.ReadSeeker, mediaType string) (image.Image, error) {
+	switch mediaType {
+	case "image/heic", "image/heif":
+		img, err := goheif.Decode(file)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't decode HEIC: %w", err)
 		}
-	} else {
-		img, _, err = image.Decode(file)
+		return img, nil
+	case mediaTypePSD:
+		img, err := decodePSD(file)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't decode image: %w", err)
+			return nil, fmt.Errorf("couldn't decode PSD: %w", err)
 		}
+		return img, nil
+	case mediaTypeProcreate:
+		ra, size, err := readerAtWithSize(file)
+		if err != nil {
+			return nil, err
+		}
+		return decodeProcreate(ra, size)
+	case mediaTypeDNG, mediaTypeCR2, mediaTypeNEF:
+		// Orientacja z kontenera jest nakładana od razu - podgląd jest już "prosty"
+		return decodeRAW(file)
 	}
 
-	// Sprawdź czy resize jest potrzebny
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-
-	if width > int(maxWidth) || height > int(maxHeight) {
-		img = resize.Thumbnail(maxWidth, maxHeight, img, resize.Lanczos3)
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode image: %w", err)
 	}
-
 	return img, nil
 }
 
-// Zapisz obraz jako WebP
-func (cfg *apiConfig) saveAsWebP(img image.Image, filename string) (int64, error) {
-	outputPath := filepath.Join(cfg.tempRoot, filename)
+// readerAtWithSize udostępnia źródło jako io.ReaderAt (np. dla archiwów ZIP)
+func readerAtWithSize(file io.ReadSeeker) (io.ReaderAt, int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, fmt.Errorf("couldn't get file size: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("couldn't rewind file: %w", err)
+	}
+	if ra, ok := file.(io.ReaderAt); ok {
+		return ra, size, nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("couldn't read file: %w", err)
+	}
+	return bytes.NewReader(data), size, nil
+}
 
+// Zapisz obraz jako WebP
+func (cfg *apiConfig) saveAsWebP(img image.Image, outputPath string, params encodeParams) (int64, error) {
 	outFile, err := os.Create(outputPath)
 	if err != nil {
 		return 0, fmt.Errorf("couldn't create output file: %w", err)
@@ -248,8 +657,8 @@ func (cfg *apiConfig) saveAsWebP(img image.Image, filename string) (int64, error
 	defer outFile.Close()
 
 	options := &webp.Options{
-		Lossless: false,
-		Quality:  80,
+		Lossless: params.Lossless,
+		Quality:  params.Quality,
 	}
 
 	if err := webp.Encode(outFile, img, options); err != nil {
@@ -265,3 +674,18 @@ func (cfg *apiConfig) saveAsWebP(img image.Image, filename string) (int64, error
 
 	return fileInfo.Size(), nil
 }
+
+// webpDimensions odczytuje wymiary zapisanego pliku WebP bez pełnego dekodowania
+func webpDimensions(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't open WebP file: %w", err)
+	}
+	defer file.Close()
+
+	config, err := webp.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't read WebP dimensions: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limity archiwum - chronią przed zip-bombami i archiwami z tysiącami drobnych plików
+const (
+	maxZipEntries          = 1000
+	maxZipEntrySize        = 512 << 20 // 512 MB po rozpakowaniu
+	maxZipUncompressedSize = 4 << 30   // 4 GB łącznie po rozpakowaniu
+)
+
+type ZipEntryResult struct {
+	Entry   string     `json:"entry"`
+	Image   *ImageInfo `json:"image,omitempty"`
+	Skipped bool       `json:"skipped,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type ZipUploadResponse struct {
+	BatchID string           `json:"batchId"`
+	Entries []ZipEntryResult `json:"entries"`
+}
+
+// uploadZipHandler przyjmuje archiwum ZIP w polu "archive" i przetwarza każdy
+// obrazek z osobna. Błąd jednego wpisu nie przerywa pozostałych.
+func (cfg *apiConfig) uploadZipHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	userID, ok := r.Context().Value(contextKeyUserID).(int)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User context error", nil)
+		return
+	}
+
+	const uploadLimit = 1 << 30 // 1 GB
+
+	r.Body = http.MaxBytesReader(w, r.Body, uploadLimit)
+	if err := r.ParseMultipartForm(uploadLimit); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
+		return
+	}
+
+	archive, archiveHeader, err := r.FormFile("archive")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "No archive provided", err)
+		return
+	}
+	defer archive.Close()
+
+	zr, err := zip.NewReader(archive, archiveHeader.Size)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read ZIP archive", err)
+		return
+	}
+	if len(zr.File) > maxZipEntries {
+		err := fmt.Errorf("archive has %d entries, limit is %d", len(zr.File), maxZipEntries)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	entries := make([]ZipEntryResult, 0, len(zr.File))
+	var imageFiles []*zip.File
+	var sourceEntries []int
+	var total uint64
+	for _, f := range zr.File {
+		result := ZipEntryResult{Entry: f.Name}
+		if f.FileInfo().IsDir() || isZipJunk(f.Name) {
+			continue
+		}
+		if err := checkZipEntryName(f.Name); err != nil {
+			result.Error = err.Error()
+			entries = append(entries, result)
+			continue
+		}
+		if _, ok := extensionMediaTypes[strings.ToLower(path.Ext(f.Name))]; !ok {
+			result.Skipped = true
+			entries = append(entries, result)
+			continue
+		}
+		if f.UncompressedSize64 > maxZipEntrySize {
+			result.Error = fmt.Sprintf("entry is larger than %d bytes", maxZipEntrySize)
+			entries = append(entries, result)
+			continue
+		}
+		total += f.UncompressedSize64
+		if total > maxZipUncompressedSize {
+			err := fmt.Errorf("archive expands to more than %d bytes", maxZipUncompressedSize)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		sourceEntries = append(sourceEntries, len(entries))
+		entries = append(entries, result)
+		imageFiles = append(imageFiles, f)
+	}
+
+	if !cfg.enforceQuota(w, r, userID, len(imageFiles), int64(total)) {
+		return
+	}
+
+	// Partię zakładamy dopiero, gdy archiwum przeszło walidację
+	opts, ok := cfg.processOptionsFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	sources := make([]imageSource, len(imageFiles))
+	for i, f := range imageFiles {
+		sources[i] = zipEntrySource(f, cfg.scratchDir())
+	}
+
+	for i, result := range cfg.processSources(r.Context(), sources, opts) {
+		entry := &entries[sourceEntries[i]]
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+			continue
+		}
+		info := result.ImageInfo
+		entry.Image = &info
+	}
+
+	log.Printf("✓ Przetworzono archiwum %s (%d plików) w %v\n",
+		archiveHeader.Filename, len(sources), time.Since(startTime))
+
+	respondWithJSON(w, http.StatusOK, ZipUploadResponse{
+		BatchID: opts.batchID,
+		Entries: entries,
+	})
+}
+
+// zipEntrySource rozpakowuje wpis do pliku tymczasowego dopiero przy otwarciu -
+// dekodery potrzebują Seek/ReaderAt, a strumień z archiwum ich nie ma
+func zipEntrySource(f *zip.File, tmpDir string) imageSource {
+	return imageSource{
+		Name: path.Base(f.Name),
+		Size: int64(f.UncompressedSize64),
+		open: func() (multipart.File, error) {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("couldn't open ZIP entry: %w", err)
+			}
+			defer rc.Close()
+
+			tmp, err := os.Create(filepath.Join(tmpDir, fmt.Sprintf(".%s.zip-entry", uuid.New().String())))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't create temp file: %w", err)
+			}
+			// Nagłówek wpisu może kłamać co do rozmiaru - czytamy najwyżej bajt więcej
+			n, err := io.Copy(tmp, io.LimitReader(rc, int64(f.UncompressedSize64)+1))
+			if err == nil && n > int64(f.UncompressedSize64) {
+				err = fmt.Errorf("ZIP entry is larger than declared")
+			}
+			if err == nil {
+				_, err = tmp.Seek(0, io.SeekStart)
+			}
+			if err != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+				return nil, fmt.Errorf("couldn't extract ZIP entry: %w", err)
+			}
+			return &tempFile{File: tmp}, nil
+		},
+	}
+}
+
+// tempFile usuwa plik z dysku przy zamknięciu
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.File.Name())
+	return err
+}
+
+// checkZipEntryName odrzuca ścieżki absolutne i wychodzące poza archiwum (zip-slip).
+// Wpisy i tak nie są zapisywane pod własną nazwą, ale taki plik świadczy o spreparowanym archiwum.
+func checkZipEntryName(name string) error {
+	if strings.Contains(name, "\\") || path.IsAbs(name) {
+		return fmt.Errorf("unsafe entry path")
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return fmt.Errorf("unsafe entry path")
+		}
+	}
+	return nil
+}
+
+// isZipJunk rozpoznaje metadane dokładane przez macOS i pliki ukryte
+func isZipJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
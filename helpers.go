@@ -4,14 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 )
 
-func (cfg *apiConfig) cleanupImages() {
-	os.RemoveAll(cfg.tempRoot)
-	os.MkdirAll(cfg.tempRoot, 0755)
-}
-
 func (cfg *apiConfig) ensureDefaultAdmin(ctx context.Context) error {
 	// Sprawdź czy są jacyś użytkownicy
 	count, err := cfg.db.CountUsers(ctx)
@@ -35,3 +29,11 @@ func (cfg *apiConfig) ensureDefaultAdmin(ctx context.Context) error {
 
 	return nil
 }
+
+// boolToInt64 zamienia bool na 0/1 dla kolumn INTEGER w SQLite
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound zwracają wszystkie sterowniki, gdy obiekt nie istnieje
+var ErrNotFound = errors.New("storage: object not found")
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage to magazyn plików adresowanych kluczami w postaci "a/b/plik.webp"
+type Storage interface {
+	// Put zapisuje obiekt (nadpisuje istniejący). size < 0 oznacza nieznany rozmiar.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete nie zwraca błędu dla nieistniejącego obiektu
+	Delete(ctx context.Context, key string) error
+	// List zwraca wszystkie obiekty, których klucz zaczyna się od prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// CleanKey odrzuca klucze wychodzące poza magazyn i normalizuje separatory
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return path.Clean(key), nil
+}
+
+// DeletePrefix usuwa wszystkie obiekty pod prefiksem
+func DeletePrefix(ctx context.Context, s Storage, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
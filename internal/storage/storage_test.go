@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testContract sprawdza zachowanie wspólne dla wszystkich sterowników Storage
+func testContract(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	put := func(t *testing.T, key, body string, size int64) {
+		t.Helper()
+		if err := s.Put(ctx, key, strings.NewReader(body), size, "image/webp"); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	get := func(t *testing.T, key string) (string, ObjectInfo) {
+		t.Helper()
+		rc, info, err := s.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("reading %s: %v", key, err)
+		}
+		return string(data), info
+	}
+
+	t.Run("PutGet", func(t *testing.T) {
+		put(t, "1/batch/a.webp", "hello", 5)
+		body, info := get(t, "1/batch/a.webp")
+		if body != "hello" || info.Size != 5 || info.Key != "1/batch/a.webp" {
+			t.Fatalf("got %q, %+v", body, info)
+		}
+	})
+
+	t.Run("PutOverwrites", func(t *testing.T) {
+		put(t, "1/batch/b.webp", "first", 5)
+		put(t, "1/batch/b.webp", "second!", 7)
+		if body, info := get(t, "1/batch/b.webp"); body != "second!" || info.Size != 7 {
+			t.Fatalf("got %q, %+v", body, info)
+		}
+	})
+
+	t.Run("PutUnknownSize", func(t *testing.T) {
+		put(t, "1/batch/c.webp", "streamed", -1)
+		if body, _ := get(t, "1/batch/c.webp"); body != "streamed" {
+			t.Fatalf("got %q", body)
+		}
+	})
+
+	t.Run("PutBinary", func(t *testing.T) {
+		data := bytes.Repeat([]byte{0, 0xff, 0x10}, 100_000)
+		if err := s.Put(ctx, "2/batch/big.webp", bytes.NewReader(data), int64(len(data)), ""); err != nil {
+			t.Fatal(err)
+		}
+		body, _ := get(t, "2/batch/big.webp")
+		if body != string(data) {
+			t.Fatalf("binary object differs after round trip (%d bytes)", len(body))
+		}
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		put(t, "1/batch/d.webp", "stat me", 7)
+		info, err := s.Stat(ctx, "1/batch/d.webp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != 7 || info.Key != "1/batch/d.webp" || info.ModTime.IsZero() {
+			t.Fatalf("got %+v", info)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, _, err := s.Get(ctx, "1/batch/missing.webp"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get: expected ErrNotFound, got %v", err)
+		}
+		if _, err := s.Stat(ctx, "1/batch/missing.webp"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat: expected ErrNotFound, got %v", err)
+		}
+		if err := s.Delete(ctx, "1/batch/missing.webp"); err != nil {
+			t.Errorf("Delete of a missing object should succeed, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		put(t, "3/x/one.webp", "1", 1)
+		put(t, "3/x/originals/one.png", "22", 2)
+		put(t, "3/xy/two.webp", "333", 3)
+		put(t, "4/x/other.webp", "4", 1)
+
+		keys := func(prefix string) []string {
+			t.Helper()
+			objects, err := s.List(ctx, prefix)
+			if err != nil {
+				t.Fatalf("List(%s): %v", prefix, err)
+			}
+			var keys []string
+			for _, obj := range objects {
+				keys = append(keys, fmt.Sprintf("%s:%d", obj.Key, obj.Size))
+			}
+			sort.Strings(keys)
+			return keys
+		}
+		if got, want := keys("3/x/"), []string{"3/x/one.webp:1", "3/x/originals/one.png:2"}; !equalStrings(got, want) {
+			t.Errorf("List(3/x/) = %v, want %v", got, want)
+		}
+		if got, want := keys("3/x"), []string{"3/x/one.webp:1", "3/x/originals/one.png:2", "3/xy/two.webp:3"}; !equalStrings(got, want) {
+			t.Errorf("List(3/x) = %v, want %v", got, want)
+		}
+		if got := keys("5/"); len(got) != 0 {
+			t.Errorf("List(5/) = %v, want nothing", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		put(t, "6/batch/e.webp", "bye", 3)
+		if err := s.Delete(ctx, "6/batch/e.webp"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Stat(ctx, "6/batch/e.webp"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+		}
+	})
+
+	t.Run("DeletePrefix", func(t *testing.T) {
+		put(t, "7/batch/a.webp", "a", 1)
+		put(t, "7/batch/originals/a.png", "b", 1)
+		put(t, "7/other/c.webp", "c", 1)
+		if err := DeletePrefix(ctx, s, "7/batch/"); err != nil {
+			t.Fatal(err)
+		}
+		objects, err := s.List(ctx, "7/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) != 1 || objects[0].Key != "7/other/c.webp" {
+			t.Fatalf("got %+v", objects)
+		}
+	})
+
+	t.Run("InvalidKeys", func(t *testing.T) {
+		for _, key := range []string{"", "../escape.webp", "a/../../b", "/abs.webp", `a\b.webp`} {
+			if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+				t.Errorf("Put(%q) should fail", key)
+			}
+		}
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLocalContract(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testContract(t, s)
+}
+
+// TestS3Contract uruchamia ten sam zestaw na prawdziwym buckecie, np. MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=http://localhost:9000 S3_TEST_BUCKET=test \
+//	S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./internal/storage
+//
+// Obiekty trafiają pod osobny prefiks i są usuwane po teście.
+func TestS3Contract(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	prefix := fmt.Sprintf("contract-test/%d/", time.Now().UnixNano())
+	s, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("S3_TEST_REGION"),
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		Prefix:    prefix,
+		PathStyle: os.Getenv("S3_TEST_VIRTUAL_HOST") == "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := DeletePrefix(context.Background(), s, ""); err != nil {
+			t.Logf("cleanup of %s failed: %v", prefix, err)
+		}
+	})
+	testContract(t, s)
+}
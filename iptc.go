@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+)
+
+// IPTC-IIM trzymany jest w zasobie Photoshopa 0x0404 - w segmencie APP13 JPEG-a
+// albo w sekcji zasobów PSD, więc w obu przypadkach szukamy nagłówka zasobu.
+
+var iptcResourceHeader = []byte("8BIM\x04\x04")
+
+const (
+	iptcTagMarker  = 0x1C
+	iptcRecordApp  = 2
+	iptcObjectName = 5
+	iptcKeywords   = 25
+	iptcCaption    = 120
+)
+
+type iptcMetadata struct {
+	Title    string
+	Caption  string
+	Keywords []string
+}
+
+// findIPTCResource zwraca dane zasobu IPTC albo nil
+func findIPTCResource(data []byte) []byte {
+	i := bytes.Index(data, iptcResourceHeader)
+	if i < 0 {
+		return nil
+	}
+	p := i + len(iptcResourceHeader)
+	if p >= len(data) {
+		return nil
+	}
+	// Nazwa zasobu to string Pascala wyrównany do parzystej długości
+	nameLen := int(data[p]) + 1
+	p += nameLen + nameLen%2
+	if p+4 > len(data) {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(data[p:]))
+	p += 4
+	if size <= 0 || p+size > len(data) {
+		return nil
+	}
+	return data[p : p+size]
+}
+
+// parseIPTC czyta tytuł, podpis i słowa kluczowe z rekordu aplikacji (2)
+func parseIPTC(data []byte) iptcMetadata {
+	var m iptcMetadata
+	for p := 0; p+5 <= len(data); {
+		if data[p] != iptcTagMarker {
+			break
+		}
+		record, dataset := data[p+1], data[p+2]
+		size := int(binary.BigEndian.Uint16(data[p+3:]))
+		p += 5
+		// Rozszerzona długość (najwyższy bit) nie występuje w polach tekstowych
+		if size&0x8000 != 0 || p+size > len(data) {
+			break
+		}
+		value := iptcString(data[p : p+size])
+		p += size
+		if record != iptcRecordApp {
+			continue
+		}
+		switch dataset {
+		case iptcObjectName:
+			m.Title = value
+		case iptcCaption:
+			m.Caption = value
+		case iptcKeywords:
+			m.Keywords = append(m.Keywords, value)
+		}
+	}
+	return m
+}
+
+// iptcString dekoduje wartość - starsze programy zapisują Latin-1 zamiast UTF-8
+func iptcString(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+// Janitor poczekalni usuwa pliki starsze niż STAGING_TTL razem z ich wpisami
+// w rejestrze oraz puste, stare partie. STAGING_TTL=0 wyłącza sprzątanie.
+// Przy okazji opróżnia kosz z plików starszych niż TRASH_RETENTION (0 = kosz bez limitu).
+
+const (
+	defaultStagingTTL      = 72 * time.Hour
+	stagingJanitorInterval = 30 * time.Minute
+)
+
+type JanitorRun struct {
+	StartedAt      time.Time `json:"startedAt"`
+	Duration       string    `json:"duration"`
+	RemovedFiles   int       `json:"removedFiles"`
+	RemovedBatches int       `json:"removedBatches"`
+	PurgedFiles    int       `json:"purgedFiles"`
+	FreedBytes     int64     `json:"freedBytes"`
+	Errors         int       `json:"errors"`
+}
+
+type JanitorTotals struct {
+	Runs           int   `json:"runs"`
+	RemovedFiles   int   `json:"removedFiles"`
+	RemovedBatches int   `json:"removedBatches"`
+	PurgedFiles    int   `json:"purgedFiles"`
+	FreedBytes     int64 `json:"freedBytes"`
+	Errors         int   `json:"errors"`
+}
+
+type stagingJanitor struct {
+	ttl            time.Duration
+	trashRetention time.Duration
+
+	mu      sync.Mutex
+	lastRun *JanitorRun
+	totals  JanitorTotals
+}
+
+func newStagingJanitor(ttl, trashRetention time.Duration) *stagingJanitor {
+	return &stagingJanitor{ttl: ttl, trashRetention: trashRetention}
+}
+
+// snapshot zwraca kopię statystyk do pokazania w API
+func (j *stagingJanitor) snapshot() (*JanitorRun, JanitorTotals) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var last *JanitorRun
+	if j.lastRun != nil {
+		run := *j.lastRun
+		last = &run
+	}
+	return last, j.totals
+}
+
+func (j *stagingJanitor) record(run JanitorRun) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastRun = &run
+	j.totals.Runs++
+	j.totals.RemovedFiles += run.RemovedFiles
+	j.totals.RemovedBatches += run.RemovedBatches
+	j.totals.PurgedFiles += run.PurgedFiles
+	j.totals.FreedBytes += run.FreedBytes
+	j.totals.Errors += run.Errors
+}
+
+func (cfg *apiConfig) startStagingJanitor(ctx context.Context) {
+	if cfg.janitor.ttl <= 0 && cfg.janitor.trashRetention <= 0 {
+		log.Println("STAGING_TTL=0 and TRASH_RETENTION=0, staging janitor disabled")
+		return
+	}
+	ticker := time.NewTicker(stagingJanitorInterval)
+	go func() {
+		defer ticker.Stop()
+		cfg.cleanExpiredStaging(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cfg.cleanExpiredStaging(ctx)
+			}
+		}
+	}()
+}
+
+func (cfg *apiConfig) cleanExpiredStaging(ctx context.Context) {
+	run := JanitorRun{StartedAt: time.Now().UTC()}
+	if cfg.janitor.ttl > 0 {
+		cfg.cleanExpiredAssets(ctx, run.StartedAt.Add(-cfg.janitor.ttl), &run)
+	}
+	if cfg.janitor.trashRetention > 0 {
+		cfg.purgeTrash(ctx, run.StartedAt.Add(-cfg.janitor.trashRetention), &run)
+	}
+	run.Duration = time.Since(run.StartedAt).String()
+	cfg.janitor.record(run)
+	if run.RemovedFiles > 0 || run.RemovedBatches > 0 || run.PurgedFiles > 0 || run.Errors > 0 {
+		log.Printf("Janitor: usunięto %d plików i %d partii, z kosza %d plików (%d bajtów), błędów: %d",
+			run.RemovedFiles, run.RemovedBatches, run.PurgedFiles, run.FreedBytes, run.Errors)
+	}
+}
+
+// cleanExpiredAssets usuwa pliki i puste partie starsze niż cutoff
+func (cfg *apiConfig) cleanExpiredAssets(ctx context.Context, cutoff time.Time, run *JanitorRun) {
+	assets, err := cfg.db.ListStagedAssetsCreatedBefore(ctx, cutoff)
+	if err != nil {
+		log.Printf("Janitor: couldn't list expired staged assets: %v", err)
+		run.Errors++
+		return
+	}
+	for _, asset := range assets {
+		freed, err := cfg.removeStagedAsset(ctx, asset)
+		if err != nil {
+			log.Printf("Janitor: couldn't remove %s: %v", asset.Filename, err)
+			run.Errors++
+			continue
+		}
+		log.Printf("Janitor: usunięto %s (partia %s, użytkownik %d)", asset.Filename, asset.BatchID, asset.UserID)
+		run.RemovedFiles++
+		run.FreedBytes += freed
+	}
+
+	// Partie bez plików w rejestrze i nieruszane od TTL (np. porzucone po uploadzie z błędem)
+	batches, err := cfg.listStagedBatches(ctx)
+	if err != nil {
+		log.Printf("Janitor: couldn't list staging: %v", err)
+		run.Errors++
+		return
+	}
+	for _, batch := range batches {
+		if batch.CreatedAt.After(cutoff) {
+			continue
+		}
+		remaining, err := cfg.db.ListStagedAssetsByBatch(ctx, database.ListStagedAssetsByBatchParams{
+			UserID:  int64(batch.UserID),
+			BatchID: batch.BatchID,
+		})
+		if err != nil || len(remaining) > 0 {
+			continue
+		}
+		if err := cfg.removeBatch(ctx, batch.UserID, batch.BatchID); err != nil {
+			log.Printf("Janitor: couldn't remove batch %s: %v", batch.BatchID, err)
+			run.Errors++
+			continue
+		}
+		run.RemovedBatches++
+	}
+}
+
+// removeStagedAsset usuwa plik WebP, jego oryginał i wpis w rejestrze; zwraca zwolnione bajty
+func (cfg *apiConfig) removeStagedAsset(ctx context.Context, asset database.StagedAsset) (int64, error) {
+	userID := int(asset.UserID)
+	var freed int64
+	keys := []string{stagingKey(userID, asset.BatchID, asset.Filename)}
+	if asset.OriginalFile != "" {
+		keys = append(keys, stagingKey(userID, asset.BatchID, asset.OriginalFile))
+	}
+	for _, key := range keys {
+		info, err := cfg.staging.Stat(ctx, key)
+		if err != nil {
+			continue
+		}
+		if err := cfg.staging.Delete(ctx, key); err != nil {
+			return freed, err
+		}
+		freed += info.Size
+	}
+	return freed, cfg.db.DeleteStagedAsset(ctx, asset.Filename)
+}
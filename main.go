@@ -6,21 +6,55 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
 	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
 )
 
 type apiConfig struct {
-	db         *database.Queries
-	port       string
-	platform   string
-	assetsRoot string
-	tempRoot   string
-	token      string
-	wpApi      wpApi
+	db            *database.Queries
+	port          string
+	platform      string
+	assetsRoot    string
+	tempRoot      string
+	token         string
+	wpApi         wpApi
+	cache         *outputCache
+	cacheMaxBytes int64
+
+	// Poczekalnia i publiczne zasoby - lokalny dysk albo bucket S3
+	storageDriver string
+	s3Config      storage.S3Config
+	staging       storage.Storage
+	assets        storage.Storage
+
+	filenameTemplate string
+	filenames        *filenameReservations
+	watermarks       *watermarkCache
+	uploadLocks      *uploadLocks
+	janitor          *stagingJanitor
+	collageSlots     chan struct{}
+
+	// Import z adresów URL
+	importMaxBytes  int64
+	importTimeout   time.Duration
+	importAllowlist importAllowlist
+	// Tryb obserwowanego folderu (komenda "watch")
+	watch watchConfig
+
+	// Import z katalogu na serwerze jest wyłączony, gdy IMPORT_ROOT nie jest ustawiony
+	importRoot string
+
+	// Magazyn oryginałów jest nil, gdy KEEP_ORIGINALS nie jest włączone
+	originals          *originalStore
+	keepOriginals      bool
+	originalsRetention time.Duration
 }
 type tattooWpDestination struct {
 	tattooUrl      string
@@ -55,6 +89,12 @@ func main() {
 	}
 	defer db.Close()
 
+	// Wyszukiwarka mediów potrzebuje FTS5 - bez niego migracje by się wyłożyły z mniej czytelnym błędem
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil || !fts5 {
+		log.Fatal("SQLite was built without FTS5, build with: go build -tags sqlite_fts5")
+	}
+
 	if err := goose.Up(db, "sql/schema"); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
@@ -65,6 +105,30 @@ func main() {
 	if err != nil {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
+	if err := cfg.openStores(); err != nil {
+		log.Fatalf("Couldn't initialize %s storage: %v", cfg.storageDriver, err)
+	}
+	cfg.cache, err = newOutputCache(filepath.Join(cfg.assetsRoot, "cache"), cfg.cacheMaxBytes)
+	if err != nil {
+		log.Fatalf("Couldn't initialize output cache: %v", err)
+	}
+
+	if cfg.keepOriginals {
+		cfg.originals = newOriginalStore(cfg.assets)
+	}
+
+	// Komendy jednorazowe, np. `goCmsAssistant purge-originals` z crona
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "purge-originals":
+			cfg.runPurgeOriginals(context.Background())
+		case "watch":
+			cfg.runWatch(context.Background())
+		default:
+			log.Fatalf("Unknown command '%s'", os.Args[1])
+		}
+		return
+	}
 
 	if cfg.platform == "dev" {
 		if err := cfg.ensureDefaultAdmin(context.Background()); err != nil {
@@ -72,16 +136,179 @@ func main() {
 		}
 	}
 
+	cfg.startUploadJanitor(context.Background())
+	cfg.startStagingJanitor(context.Background())
+
 	mux := http.NewServeMux()
 	// mux.Handle("/",)
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(cfg.assetsRoot)))
-
-	mux.Handle("/assets/", assetsHandler)
+	// Cache i oryginały leżą obok zasobów, ale nie są publiczne - blokuje je assetsHandler
+	mux.HandleFunc("GET /assets/{path...}", cfg.assetsHandler)
+	// Podglądy z poczekalni - tylko pojedyncze pliki, bez listowania katalogów
+	mux.HandleFunc("GET /staging/{userID}/{batchID}/{filename}", cfg.stagingFileHandler)
+	mux.HandleFunc("GET /staging/trash/{userID}/{batchID}/{filename}", cfg.trashFileHandler)
 	mux.HandleFunc("GET /api", cfg.indexHandler)
-	mux.HandleFunc("POST /api/images/upload", cfg.uploadImagesHandler)
-	mux.HandleFunc("DELETE /api/images/delete/{filename}", cfg.deleteImageHandler)
-	mux.HandleFunc("DELETE /api/images/cleanup", cfg.cleanupImagesHandler)
-	mux.HandleFunc("POST /api/images/send", cfg.sendImagesHandler)
+	mux.Handle("GET /api/images",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.listImagesHandler),
+		),
+	)
+	mux.Handle("PATCH /api/images/{filename}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.updateImageMetadataHandler),
+		),
+	)
+	mux.Handle("POST /api/images/{filename}/edit",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.editImageHandler),
+		),
+	)
+	mux.Handle("PUT /api/images/{filename}/tags",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.setImageTagsHandler),
+		),
+	)
+	mux.Handle("GET /api/tags",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.listTagsHandler),
+		),
+	)
+	mux.Handle("GET /api/media",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.listMediaHandler),
+		),
+	)
+	mux.Handle("GET /api/media/search",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.searchMediaHandler),
+		),
+	)
+	mux.Handle("PUT /api/media/{id}/tags",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.setMediaTagsHandler),
+		),
+	)
+	mux.Handle("GET /api/collections",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.listCollectionsHandler),
+		),
+	)
+	mux.Handle("POST /api/collections",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.createCollectionHandler),
+		),
+	)
+	mux.Handle("GET /api/collections/{id}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.getCollectionHandler),
+		),
+	)
+	mux.Handle("PATCH /api/collections/{id}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.updateCollectionHandler),
+		),
+	)
+	mux.Handle("DELETE /api/collections/{id}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.deleteCollectionHandler),
+		),
+	)
+	mux.Handle("POST /api/collections/{id}/items",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.addCollectionItemsHandler),
+		),
+	)
+	mux.Handle("DELETE /api/collections/{id}/items/{filename}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.removeCollectionItemHandler),
+		),
+	)
+	mux.Handle("POST /api/collections/{id}/publish",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.publishCollectionHandler),
+		),
+	)
+	mux.Handle("GET /api/quota",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.quotaHandler),
+		),
+	)
+	mux.Handle("POST /api/images/upload",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.uploadImagesHandler),
+		),
+	)
+	mux.Handle("POST /api/images/upload/zip",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.uploadZipHandler),
+		),
+	)
+	mux.Handle("POST /api/images/import",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.importImagesHandler),
+		),
+	)
+	mux.Handle("POST /api/images/collage",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.collageHandler),
+		),
+	)
+	mux.Handle("DELETE /api/images/delete/{filename}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.deleteImageHandler),
+		),
+	)
+	mux.Handle("GET /api/images/trash",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.listTrashHandler),
+		),
+	)
+	mux.Handle("POST /api/images/{filename}/restore",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.restoreImageHandler),
+		),
+	)
+	mux.Handle("DELETE /api/images/cleanup",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.cleanupImagesHandler),
+		),
+	)
+	mux.Handle("POST /api/images/send",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.sendImagesHandler),
+		),
+	)
+	mux.Handle("GET /api/batches/{id}/archive",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.batchArchiveHandler),
+		),
+	)
+	// Wznawialne uploady (tus)
+	mux.Handle("OPTIONS /api/uploads", tusMiddleware(http.HandlerFunc(cfg.tusOptionsHandler)))
+	mux.Handle("POST /api/uploads",
+		tusMiddleware(cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.tusCreateHandler),
+		)),
+	)
+	mux.Handle("HEAD /api/uploads/{id}",
+		tusMiddleware(cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.tusHeadHandler),
+		)),
+	)
+	mux.Handle("PATCH /api/uploads/{id}",
+		tusMiddleware(cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.tusPatchHandler),
+		)),
+	)
+	mux.Handle("DELETE /api/uploads/{id}",
+		tusMiddleware(cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.tusDeleteHandler),
+		)),
+	)
+	mux.Handle("GET /api/uploads/{id}",
+		cfg.authenticationMiddleware(
+			http.HandlerFunc(cfg.uploadStatusHandler),
+		),
+	)
 	mux.HandleFunc("POST /api/auth/login", cfg.loginHandler)
 	mux.Handle("POST /api/auth/logout",
 		cfg.refreshTokenValidationMiddleware(
@@ -101,6 +328,90 @@ func main() {
 		),
 	)
 	mux.HandleFunc("POST /api/admin/reset", cfg.resetAdminHandler)
+	mux.Handle("POST /api/admin/import/directory",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.importDirectoryHandler),
+			),
+		),
+	)
+	mux.Handle("GET /api/admin/janitor",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.stagingJanitorHandler),
+			),
+		),
+	)
+	mux.Handle("DELETE /api/admin/tags/{id}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.deleteTagHandler),
+			),
+		),
+	)
+	mux.Handle("GET /api/admin/quotas",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.listQuotasHandler),
+			),
+		),
+	)
+	mux.Handle("PUT /api/admin/quotas/roles/{role}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.saveRoleQuotaHandler),
+			),
+		),
+	)
+	mux.Handle("DELETE /api/admin/quotas/roles/{role}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.deleteRoleQuotaHandler),
+			),
+		),
+	)
+	mux.Handle("PUT /api/admin/quotas/users/{id}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.saveUserQuotaHandler),
+			),
+		),
+	)
+	mux.Handle("DELETE /api/admin/quotas/users/{id}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.deleteUserQuotaHandler),
+			),
+		),
+	)
+	mux.Handle("GET /api/admin/pipelines",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.listPipelinesHandler),
+			),
+		),
+	)
+	mux.Handle("GET /api/admin/pipelines/{destination}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.getPipelineHandler),
+			),
+		),
+	)
+	mux.Handle("PUT /api/admin/pipelines/{destination}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.savePipelineHandler),
+			),
+		),
+	)
+	mux.Handle("DELETE /api/admin/pipelines/{destination}",
+		cfg.authenticationMiddleware(
+			cfg.adminMiddleware(
+				http.HandlerFunc(cfg.deletePipelineHandler),
+			),
+		),
+	)
 
 	srv := &http.Server{
 		Addr:    "0.0.0.0:" + cfg.port, // ✅ Jawnie IPv4
@@ -171,6 +482,125 @@ func loadEnv() apiConfig {
 	if wpBaseUrl == "" {
 		log.Fatal("WP_BASE_URL environment variable is not set")
 	}
+	filenameTemplate := os.Getenv("FILENAME_TEMPLATE")
+	if filenameTemplate == "" {
+		filenameTemplate = defaultFilenameTemplate
+	}
+	if err := validateFilenameTemplate(filenameTemplate); err != nil {
+		log.Fatalf("Invalid FILENAME_TEMPLATE '%s': %v", filenameTemplate, err)
+	}
+	stagingTTL := defaultStagingTTL
+	if v := os.Getenv("STAGING_TTL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Fatalf("STAGING_TTL must be a duration like '72h', got '%s'", v)
+		}
+		stagingTTL = parsed
+	}
+	trashRetention := defaultTrashRetention
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Fatalf("TRASH_RETENTION must be a duration like '168h', got '%s'", v)
+		}
+		trashRetention = parsed
+	}
+	keepOriginals, _ := strconv.ParseBool(os.Getenv("KEEP_ORIGINALS"))
+	var originalsRetention time.Duration
+	if v := os.Getenv("ORIGINALS_RETENTION"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Fatalf("ORIGINALS_RETENTION must be a duration like '2160h', got '%s'", v)
+		}
+		originalsRetention = parsed
+	}
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	if storageDriver == "" {
+		storageDriver = "local"
+	}
+	var s3Config storage.S3Config
+	switch storageDriver {
+	case "local":
+	case "s3":
+		s3Config = storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}
+		s3Config.PathStyle, _ = strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+		if s3Config.Endpoint == "" || s3Config.Bucket == "" {
+			log.Fatal("S3_ENDPOINT and S3_BUCKET environment variables are required when STORAGE_DRIVER=s3")
+		}
+		if s3Config.AccessKey == "" || s3Config.SecretKey == "" {
+			log.Fatal("S3_ACCESS_KEY and S3_SECRET_KEY environment variables are required when STORAGE_DRIVER=s3")
+		}
+	default:
+		log.Fatalf("STORAGE_DRIVER must be 'local' or 's3', got '%s'", storageDriver)
+	}
+	cacheMaxBytes := int64(defaultCacheMaxBytes)
+	if v := os.Getenv("CACHE_MAX_BYTES"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("CACHE_MAX_BYTES must be a positive integer, got '%s'", v)
+		}
+		cacheMaxBytes = parsed
+	}
+	importMaxBytes := int64(defaultImportMaxBytes)
+	if v := os.Getenv("IMPORT_MAX_BYTES"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("IMPORT_MAX_BYTES must be a positive integer, got '%s'", v)
+		}
+		importMaxBytes = parsed
+	}
+	importTimeout := defaultImportTimeout
+	if v := os.Getenv("IMPORT_TIMEOUT"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("IMPORT_TIMEOUT must be a duration like '30s', got '%s'", v)
+		}
+		importTimeout = parsed
+	}
+	// Adresy prywatne są domyślnie zablokowane, np. IMPORT_ALLOWLIST=127.0.0.1,minio.local
+	importAllowlist, err := parseImportAllowlist(os.Getenv("IMPORT_ALLOWLIST"))
+	if err != nil {
+		log.Fatalf("Invalid IMPORT_ALLOWLIST: %v", err)
+	}
+	importRoot := os.Getenv("IMPORT_ROOT")
+	if importRoot != "" {
+		// Rozwiązujemy od razu, żeby sprawdzanie granicy porównywało ścieżki bez dowiązań
+		resolved, err := filepath.EvalSymlinks(importRoot)
+		if err != nil {
+			log.Fatalf("IMPORT_ROOT '%s' is not accessible: %v", importRoot, err)
+		}
+		importRoot, err = filepath.Abs(resolved)
+		if err != nil {
+			log.Fatalf("IMPORT_ROOT '%s' is not accessible: %v", importRoot, err)
+		}
+	}
+	watchAutoQuality, _ := strconv.ParseBool(os.Getenv("WATCH_AUTO_QUALITY"))
+	watchAutoPublish, _ := strconv.ParseBool(os.Getenv("WATCH_AUTO_PUBLISH"))
+	watchSettle := defaultWatchSettle
+	if v := os.Getenv("WATCH_SETTLE"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("WATCH_SETTLE must be a duration like '5s', got '%s'", v)
+		}
+		watchSettle = parsed
+	}
+	watch := watchConfig{
+		dir:  os.Getenv("WATCH_DIR"),
+		user: os.Getenv("WATCH_USER"),
+		settings: uploadSettings{
+			Preset:      os.Getenv("WATCH_PRESET"),
+			Destination: os.Getenv("WATCH_DESTINATION"),
+			AutoQuality: watchAutoQuality,
+		},
+		autoPublish: watchAutoPublish,
+		settle:      watchSettle,
+	}
 	wp := wpApi{
 		tattoo: tattooWpDestination{
 			tattooUrl:      wpTattooUrl,
@@ -186,12 +616,32 @@ func loadEnv() apiConfig {
 		user:    wpUser,
 	}
 	cfg := apiConfig{
-		port:       port,
-		platform:   platform,
-		assetsRoot: assetsRoot,
-		tempRoot:   tempRoot,
-		token:      token,
-		wpApi:      wp,
+		port:          port,
+		platform:      platform,
+		assetsRoot:    assetsRoot,
+		tempRoot:      tempRoot,
+		token:         token,
+		wpApi:         wp,
+		cacheMaxBytes: cacheMaxBytes,
+		storageDriver: storageDriver,
+		s3Config:      s3Config,
+
+		importMaxBytes:  importMaxBytes,
+		importTimeout:   importTimeout,
+		importAllowlist: importAllowlist,
+		importRoot:      importRoot,
+
+		watch: watch,
+
+		filenameTemplate: filenameTemplate,
+		filenames:        newFilenameReservations(),
+		watermarks:       newWatermarkCache(),
+		uploadLocks:      newUploadLocks(),
+		janitor:          newStagingJanitor(stagingTTL, trashRetention),
+		collageSlots:     make(chan struct{}, numWorkers),
+
+		keepOriginals:      keepOriginals,
+		originalsRetention: originalsRetention,
 	}
 	return cfg
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Metadane zdjęcia zapisane w źródle: datę wykonania i aparat bierzemy z EXIF,
+// tytuł, podpis i słowa kluczowe z XMP, a gdy go nie ma - z IPTC.
+// Daty trzymamy jako czas lokalny aparatu (w strefie UTC) - EXIF zwykle nie zapisuje
+// strefy, a WordPress i tak interpretuje datę mediów w strefie strony.
+
+const (
+	// Pakiety XMP i zasoby IPTC leżą na początku pliku (poza RAW, czytanymi w całości)
+	metadataScanLimit = 4 << 20
+	maxKeywords       = 50
+	maxKeywordLength  = 100
+)
+
+type captureMetadata struct {
+	CapturedAt  *time.Time
+	CameraModel string
+	Title       string
+	Caption     string
+	Keywords    []string
+}
+
+// readCaptureMetadata odczytuje metadane ze źródła; brakujące lub uszkodzone bloki
+// są pomijane. Po odczycie źródło jest przewijane na początek.
+func readCaptureMetadata(r io.ReadSeeker, mediaType string) captureMetadata {
+	defer r.Seek(0, io.SeekStart)
+
+	var m captureMetadata
+	var head []byte
+	var err error
+	switch mediaType {
+	case mediaTypeDNG, mediaTypeCR2, mediaTypeNEF:
+		// RAW to kontener TIFF - EXIF jest w nim bezpośrednio
+		head, err = io.ReadAll(r)
+		if err != nil {
+			return m
+		}
+		m.applyExif(head)
+	default:
+		if exif, err := readExif(r, mediaType); err == nil {
+			m.applyExif(exif)
+		}
+		head, err = io.ReadAll(io.LimitReader(r, metadataScanLimit))
+		if err != nil {
+			return m
+		}
+	}
+
+	xmp := parseXMP(findXMPPacket(head))
+	iptc := parseIPTC(findIPTCResource(head))
+	if m.CapturedAt == nil {
+		m.CapturedAt = xmp.CapturedAt
+	}
+	if m.CameraModel == "" {
+		m.CameraModel = xmp.CameraModel
+	}
+	m.Title = firstNonEmpty(xmp.Title, iptc.Title)
+	m.Caption = firstNonEmpty(xmp.Caption, iptc.Caption)
+	m.Keywords = xmp.Keywords
+	if len(m.Keywords) == 0 {
+		m.Keywords = iptc.Keywords
+	}
+	m.Keywords = normalizeKeywords(m.Keywords)
+	return m
+}
+
+// applyExif czyta model aparatu z IFD0 i datę wykonania z podkatalogu EXIF
+func (m *captureMetadata) applyExif(data []byte) {
+	t, offset, err := parseTIFF(data)
+	if err != nil {
+		return
+	}
+	entries, _, err := t.readIFD(offset)
+	if err != nil {
+		return
+	}
+	var maker, model string
+	if e, ok := findTag(entries, tagMake); ok {
+		maker, _ = t.string(e)
+	}
+	if e, ok := findTag(entries, tagModel); ok {
+		model, _ = t.string(e)
+	}
+	m.CameraModel = cameraName(maker, model)
+
+	e, ok := findTag(entries, tagExifIFD)
+	if !ok {
+		return
+	}
+	exifOffset, err := t.uint(e)
+	if err != nil {
+		return
+	}
+	exifEntries, _, err := t.readIFD(exifOffset)
+	if err != nil {
+		return
+	}
+	if e, ok := findTag(exifEntries, tagDateTimeOriginal); ok {
+		if s, err := t.string(e); err == nil {
+			m.CapturedAt = parseCaptureTime(s)
+		}
+	}
+}
+
+// cameraName dokleja producenta, jeśli model go nie zawiera ("SONY" + "ILCE-7M3").
+// Producenci zapisują go różnie ("NIKON CORPORATION" i "NIKON D850"), więc porównujemy pierwsze słowo.
+func cameraName(maker, model string) string {
+	if model == "" {
+		return maker
+	}
+	fields := strings.Fields(maker)
+	if len(fields) == 0 || strings.HasPrefix(strings.ToLower(model), strings.ToLower(fields[0])) {
+		return model
+	}
+	return maker + " " + model
+}
+
+// Formaty dat: EXIF ("2006:01:02 15:04:05") i ISO 8601 z XMP (z sekundami, bez nich, ze strefą)
+var captureTimeLayouts = []string{
+	"2006:01:02 15:04:05",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseCaptureTime zwraca czas lokalny aparatu; strefa, jeśli jest, zostaje pominięta
+func parseCaptureTime(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range captureTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		// Aparaty bez ustawionego zegara zapisują zera albo 1970
+		if t.Year() < 1900 {
+			return nil
+		}
+		local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+		return &local
+	}
+	return nil
+}
+
+// normalizeKeywords przycina słowa, usuwa puste i powtórzenia (bez względu na wielkość liter)
+func normalizeKeywords(keywords []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range keywords {
+		k = truncateRunes(strings.TrimSpace(k), maxKeywordLength)
+		if k == "" || seen[strings.ToLower(k)] {
+			continue
+		}
+		seen[strings.ToLower(k)] = true
+		out = append(out, k)
+		if len(out) == maxKeywords {
+			break
+		}
+	}
+	return out
+}
+
+func encodeKeywords(keywords []string) string {
+	if len(keywords) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(keywords)
+	return string(data)
+}
+
+func parseKeywords(data string) []string {
+	var keywords []string
+	if err := json.Unmarshal([]byte(data), &keywords); err != nil || keywords == nil {
+		return []string{}
+	}
+	return keywords
+}
+
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:limit]))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
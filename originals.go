@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
+)
+
+// originalStore trzyma oryginały opublikowanych plików w magazynie zasobów,
+// adresowane sha256 treści: originals/<2 pierwsze znaki>/<hash>.
+// Ten sam plik wysłany kilka razy zajmuje miejsce tylko raz.
+type originalStore struct {
+	store storage.Storage
+}
+
+func newOriginalStore(store storage.Storage) *originalStore {
+	return &originalStore{store: store}
+}
+
+func (s *originalStore) key(hash string) string {
+	return path.Join("originals", hash[:2], hash)
+}
+
+// put kopiuje obiekt z poczekalni do magazynu, jeśli jeszcze go tam nie ma
+func (s *originalStore) put(ctx context.Context, hash string, src storage.Storage, srcKey string) (int64, error) {
+	if info, err := s.store.Stat(ctx, s.key(hash)); err == nil {
+		return info.Size, nil
+	}
+
+	rc, info, err := src.Get(ctx, srcKey)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't open original: %w", err)
+	}
+	defer rc.Close()
+
+	// Sterowniki zapisują atomowo - przerwana kopia nie zostawi uciętego oryginału
+	if err := s.store.Put(ctx, s.key(hash), rc, info.Size, ""); err != nil {
+		return 0, fmt.Errorf("couldn't store original: %w", err)
+	}
+	return info.Size, nil
+}
+
+func (s *originalStore) remove(ctx context.Context, hash string) error {
+	return s.store.Delete(ctx, s.key(hash))
+}
+
+// retainOriginal przenosi oryginał pliku z poczekalni do magazynu i zwraca jego hash.
+// Zwraca nil, gdy przechowywanie jest wyłączone albo plik nie ma zachowanego oryginału.
+func (cfg *apiConfig) retainOriginal(ctx context.Context, asset database.StagedAsset) (*string, error) {
+	if cfg.originals == nil || asset.OriginalFile == "" || asset.SourceHash == "" {
+		return nil, nil
+	}
+	srcKey := stagingKey(int(asset.UserID), asset.BatchID, asset.OriginalFile)
+	size, err := cfg.originals.put(ctx, asset.SourceHash, cfg.staging, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	_, err = cfg.db.UpsertOriginal(ctx, database.UpsertOriginalParams{
+		Hash:      asset.SourceHash,
+		MediaType: asset.MediaType,
+		Size:      size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't record original: %w", err)
+	}
+	return &asset.SourceHash, nil
+}
+
+// purgeOriginals usuwa oryginały nieużywane dłużej niż retention.
+// Wpisy w historii zostają, tracą tylko powiązanie z oryginałem.
+func (cfg *apiConfig) purgeOriginals(ctx context.Context, store *originalStore, retention time.Duration) (int, int64, error) {
+	expired, err := cfg.db.ListExpiredOriginals(ctx, time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't list expired originals: %w", err)
+	}
+
+	var removed int
+	var freed int64
+	for _, original := range expired {
+		hash := original.Hash
+		if err := cfg.db.UnlinkOriginalFromHistory(ctx, &hash); err != nil {
+			return removed, freed, fmt.Errorf("couldn't unlink original %s: %w", hash, err)
+		}
+		if err := store.remove(ctx, hash); err != nil {
+			return removed, freed, fmt.Errorf("couldn't remove original %s: %w", hash, err)
+		}
+		if err := cfg.db.DeleteOriginal(ctx, hash); err != nil {
+			return removed, freed, fmt.Errorf("couldn't delete original %s: %w", hash, err)
+		}
+		removed++
+		freed += original.Size
+	}
+	return removed, freed, nil
+}
+
+// runPurgeOriginals to komenda "purge-originals" uruchamiana z crona
+func (cfg *apiConfig) runPurgeOriginals(ctx context.Context) {
+	if cfg.originalsRetention <= 0 {
+		log.Println("ORIGINALS_RETENTION is not set, nothing to purge")
+		return
+	}
+	removed, freed, err := cfg.purgeOriginals(ctx, newOriginalStore(cfg.assets), cfg.originalsRetention)
+	if err != nil {
+		log.Fatalf("Purge failed after removing %d originals: %v", removed, err)
+	}
+	log.Printf("✓ Usunięto %d oryginałów starszych niż %v (%d bajtów)\n", removed, cfg.originalsRetention, freed)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
+	"github.com/nfnt/resize"
+)
+
+// Pipeline to deklaratywna lista kroków przetwarzania zapisywana per destynacja.
+// Dekodowanie jest zawsze pierwsze, a "encode" musi być ostatnim krokiem.
+type Pipeline struct {
+	Steps []PipelineStep `json:"steps"`
+}
+
+type PipelineStep struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// sourceMeta to informacje o źródle potrzebne krokom (np. orientacja EXIF)
+type sourceMeta struct {
+	Orientation int
+}
+
+type stepFunc func(img image.Image, meta sourceMeta) (image.Image, error)
+
+type encodeParams struct {
+	Quality  float32 `json:"quality"`
+	Lossless bool    `json:"lossless"`
+	// Jeśli > 0, jakość jest podnoszona aż SSIM wyniku osiągnie ten próg
+	MinSSIM float64 `json:"minSsim"`
+}
+
+// compiledPipeline to zwalidowany potok gotowy do uruchomienia
+type compiledPipeline struct {
+	steps       []stepFunc
+	encode      encodeParams
+	fingerprint string
+	// editsAt to liczba kroków wykonywanych przed edycjami użytkownika (ostatni
+	// krok orient/crop i wszystko przed nim). Edycje odnoszą się do podglądu, czyli
+	// do obrazu już obróconego i przyciętego przez potok; resize ich nie zmienia,
+	// bo kadr zapisany jest ułamkami, a po kadrze obraz zachowuje pełną rozdzielczość.
+	editsAt int
+}
+
+// stepParser waliduje parametry kroku i zwraca funkcję oraz parametry po
+// uzupełnieniu wartości domyślnych (z nich liczony jest odcisk potoku)
+type stepParser func(ctx context.Context, cfg *apiConfig, params json.RawMessage, preset imagePreset) (stepFunc, any, error)
+
+var pipelineSteps = map[string]stepParser{
+	"orient":    parseOrientStep,
+	"crop":      parseCropStep,
+	"resize":    parseResizeStep,
+	"sharpen":   parseSharpenStep,
+	"watermark": parseWatermarkStep,
+}
+
+const encodeStepType = "encode"
+
+// defaultPipeline odtwarza dotychczasowe przetwarzanie: resize + encode według presetu
+func defaultPipeline() Pipeline {
+	return Pipeline{Steps: []PipelineStep{
+		{Type: "resize"},
+		{Type: encodeStepType},
+	}}
+}
+
+// compilePipeline sprawdza definicję i przygotowuje kroki. Parametry pominięte
+// w krokach resize/encode są brane z presetu.
+func (cfg *apiConfig) compilePipeline(ctx context.Context, p Pipeline, preset imagePreset) (compiledPipeline, error) {
+	if len(p.Steps) == 0 {
+		return compiledPipeline{}, fmt.Errorf("pipeline has no steps")
+	}
+	last := p.Steps[len(p.Steps)-1]
+	if last.Type != encodeStepType {
+		return compiledPipeline{}, fmt.Errorf("last step must be '%s'", encodeStepType)
+	}
+
+	type resolvedStep struct {
+		Type   string `json:"type"`
+		Params any    `json:"params"`
+	}
+	var compiled compiledPipeline
+	var resolved []resolvedStep
+
+	for i, step := range p.Steps[:len(p.Steps)-1] {
+		if step.Type == encodeStepType {
+			return compiledPipeline{}, fmt.Errorf("step %d: '%s' is only allowed as the last step", i+1, encodeStepType)
+		}
+		parse, ok := pipelineSteps[step.Type]
+		if !ok {
+			return compiledPipeline{}, fmt.Errorf("step %d: unknown step type '%s'", i+1, step.Type)
+		}
+		fn, params, err := parse(ctx, cfg, step.Params, preset)
+		if err != nil {
+			return compiledPipeline{}, fmt.Errorf("step %d (%s): %w", i+1, step.Type, err)
+		}
+		compiled.steps = append(compiled.steps, fn)
+		if step.Type == "orient" || step.Type == "crop" {
+			compiled.editsAt = len(compiled.steps)
+		}
+		resolved = append(resolved, resolvedStep{Type: step.Type, Params: params})
+	}
+
+	compiled.encode = encodeParams{Quality: preset.Quality, MinSSIM: preset.MinSSIM}
+	if err := decodeStepParams(last.Params, &compiled.encode); err != nil {
+		return compiledPipeline{}, fmt.Errorf("step %d (%s): %w", len(p.Steps), encodeStepType, err)
+	}
+	if compiled.encode.Quality <= 0 || compiled.encode.Quality > 100 {
+		return compiledPipeline{}, fmt.Errorf("step %d (%s): quality must be between 1 and 100", len(p.Steps), encodeStepType)
+	}
+	if compiled.encode.MinSSIM < 0 || compiled.encode.MinSSIM >= 1 {
+		return compiledPipeline{}, fmt.Errorf("step %d (%s): minSsim must be between 0 and 1", len(p.Steps), encodeStepType)
+	}
+	resolved = append(resolved, resolvedStep{Type: encodeStepType, Params: compiled.encode})
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return compiledPipeline{}, fmt.Errorf("couldn't marshal pipeline: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	compiled.fingerprint = hex.EncodeToString(sum[:])
+	return compiled, nil
+}
+
+// run wykonuje kolejne kroki na zdekodowanym obrazie
+func (p compiledPipeline) run(img image.Image, meta sourceMeta) (image.Image, error) {
+	return p.runWithEdits(img, meta, nil)
+}
+
+// runWithEdits wykonuje potok, nakładając edycje użytkownika po krokach kadrujących
+func (p compiledPipeline) runWithEdits(img image.Image, meta sourceMeta, edits []imageEdit) (image.Image, error) {
+	var err error
+	for i, step := range p.steps {
+		if i == p.editsAt {
+			img = applyEdits(img, edits)
+		}
+		img, err = step(img, meta)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.editsAt == len(p.steps) {
+		img = applyEdits(img, edits)
+	}
+	return img, nil
+}
+
+// decodeStepParams dekoduje parametry kroku, odrzucając nieznane pola
+func decodeStepParams(raw json.RawMessage, dst any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+func parseOrientStep(ctx context.Context, cfg *apiConfig, raw json.RawMessage, preset imagePreset) (stepFunc, any, error) {
+	var params struct{}
+	if err := decodeStepParams(raw, &params); err != nil {
+		return nil, nil, err
+	}
+	return func(img image.Image, meta sourceMeta) (image.Image, error) {
+		return applyOrientation(img, meta.Orientation), nil
+	}, params, nil
+}
+
+type cropParams struct {
+	Aspect  string `json:"aspect"`
+	Gravity string `json:"gravity"`
+}
+
+func parseCropStep(ctx context.Context, cfg *apiConfig, raw json.RawMessage, preset imagePreset) (stepFunc, any, error) {
+	params := cropParams{Gravity: "center"}
+	if err := decodeStepParams(raw, &params); err != nil {
+		return nil, nil, err
+	}
+	ratio, err := parseAspect(params.Aspect)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch params.Gravity {
+	case "center", "top", "bottom", "left", "right":
+	default:
+		return nil, nil, fmt.Errorf("invalid gravity '%s'", params.Gravity)
+	}
+	return func(img image.Image, meta sourceMeta) (image.Image, error) {
+		return cropToAspect(img, ratio, params.Gravity), nil
+	}, params, nil
+}
+
+// parseAspect zamienia zapis "16:9" na proporcję szerokość/wysokość
+func parseAspect(aspect string) (float64, error) {
+	w, h, ok := strings.Cut(aspect, ":")
+	if !ok {
+		return 0, fmt.Errorf("aspect must look like '16:9', got '%s'", aspect)
+	}
+	fw, err1 := strconv.ParseFloat(w, 64)
+	fh, err2 := strconv.ParseFloat(h, 64)
+	if err1 != nil || err2 != nil || fw <= 0 || fh <= 0 {
+		return 0, fmt.Errorf("invalid aspect '%s'", aspect)
+	}
+	return fw / fh, nil
+}
+
+type resizeParams struct {
+	MaxWidth  uint `json:"maxWidth"`
+	MaxHeight uint `json:"maxHeight"`
+}
+
+func parseResizeStep(ctx context.Context, cfg *apiConfig, raw json.RawMessage, preset imagePreset) (stepFunc, any, error) {
+	params := resizeParams{
+		MaxWidth:  preset.MaxWidth,
+		MaxHeight: preset.MaxHeight,
+	}
+	if err := decodeStepParams(raw, &params); err != nil {
+		return nil, nil, err
+	}
+	if params.MaxWidth == 0 || params.MaxHeight == 0 {
+		return nil, nil, fmt.Errorf("maxWidth and maxHeight must be positive")
+	}
+	return func(img image.Image, meta sourceMeta) (image.Image, error) {
+		return resizeToFit(img, params.MaxWidth, params.MaxHeight), nil
+	}, params, nil
+}
+
+// resizeToFit zmniejsza obraz tylko wtedy, gdy przekracza limity
+func resizeToFit(img image.Image, maxWidth, maxHeight uint) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() > int(maxWidth) || bounds.Dy() > int(maxHeight) {
+		return resize.Thumbnail(maxWidth, maxHeight, img, resize.Lanczos3)
+	}
+	return img
+}
+
+type sharpenParams struct {
+	Amount float64 `json:"amount"`
+	Radius int     `json:"radius"`
+}
+
+func parseSharpenStep(ctx context.Context, cfg *apiConfig, raw json.RawMessage, preset imagePreset) (stepFunc, any, error) {
+	params := sharpenParams{Amount: 0.5, Radius: 1}
+	if err := decodeStepParams(raw, &params); err != nil {
+		return nil, nil, err
+	}
+	if params.Amount <= 0 || params.Amount > 5 {
+		return nil, nil, fmt.Errorf("amount must be between 0 and 5")
+	}
+	if params.Radius < 1 || params.Radius > 10 {
+		return nil, nil, fmt.Errorf("radius must be between 1 and 10")
+	}
+	return func(img image.Image, meta sourceMeta) (image.Image, error) {
+		return sharpen(img, params.Amount, params.Radius), nil
+	}, params, nil
+}
+
+type watermarkParams struct {
+	Image    string  `json:"image"`
+	Position string  `json:"position"`
+	Opacity  float64 `json:"opacity"`
+	Scale    float64 `json:"scale"`
+	Margin   float64 `json:"margin"`
+}
+
+// Znaki wodne leżą w magazynie zasobów pod watermarks/, w potoku podaje się samą nazwę pliku
+func watermarkKey(name string) string {
+	return "watermarks/" + name
+}
+
+// watermarkCache trzyma zdekodowane znaki wodne, żeby kompilacja potoku przy
+// każdym uploadzie nie czytała i nie dekodowała pliku od nowa. Wersja (rozmiar
+// i czas modyfikacji) jest sprawdzana przez Stat, więc podmieniony plik zostanie
+// wczytany ponownie.
+type watermarkCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedWatermark
+}
+
+type cachedWatermark struct {
+	version string
+	img     image.Image
+}
+
+func newWatermarkCache() *watermarkCache {
+	return &watermarkCache{entries: map[string]cachedWatermark{}}
+}
+
+// load zwraca zdekodowany znak wodny i jego wersję do odcisku potoku
+func (c *watermarkCache) load(ctx context.Context, store storage.Storage, key string) (image.Image, string, error) {
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't open watermark: %w", err)
+	}
+	version := fmt.Sprintf("%d-%d", info.Size, info.ModTime.Unix())
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && entry.version == version {
+		return entry.img, version, nil
+	}
+
+	// Dekodowanie poza blokadą - równoległe kompilacje najwyżej zdekodują plik dwa razy
+	file, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't open watermark: %w", err)
+	}
+	defer file.Close()
+	mark, _, err := image.Decode(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't decode watermark: %w", err)
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cachedWatermark{version: version, img: mark}
+	c.mu.Unlock()
+	return mark, version, nil
+}
+
+func parseWatermarkStep(ctx context.Context, cfg *apiConfig, raw json.RawMessage, preset imagePreset) (stepFunc, any, error) {
+	params := watermarkParams{
+		Position: "bottom-right",
+		Opacity:  0.5,
+		Scale:    0.2,
+		Margin:   0.02,
+	}
+	if err := decodeStepParams(raw, &params); err != nil {
+		return nil, nil, err
+	}
+	if params.Image == "" || params.Image != filepath.Base(params.Image) {
+		return nil, nil, fmt.Errorf("image must be a file name from the watermarks directory")
+	}
+	switch params.Position {
+	case "top-left", "top-right", "bottom-left", "bottom-right", "center":
+	default:
+		return nil, nil, fmt.Errorf("invalid position '%s'", params.Position)
+	}
+	if params.Opacity <= 0 || params.Opacity > 1 {
+		return nil, nil, fmt.Errorf("opacity must be between 0 and 1")
+	}
+	if params.Scale <= 0 || params.Scale > 1 {
+		return nil, nil, fmt.Errorf("scale must be between 0 and 1")
+	}
+	if params.Margin < 0 || params.Margin > 0.5 {
+		return nil, nil, fmt.Errorf("margin must be between 0 and 0.5")
+	}
+
+	mark, version, err := cfg.watermarks.load(ctx, cfg.assets, watermarkKey(params.Image))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Podmiana pliku znaku wodnego musi zmienić odcisk potoku (i unieważnić cache)
+	resolved := struct {
+		watermarkParams
+		Version string `json:"version"`
+	}{watermarkParams: params, Version: version}
+
+	return func(img image.Image, meta sourceMeta) (image.Image, error) {
+		b := img.Bounds()
+		width := uint(float64(b.Dx()) * params.Scale)
+		if width == 0 {
+			return img, nil
+		}
+		scaled := resize.Resize(width, 0, mark, resize.Lanczos3)
+		sb := scaled.Bounds()
+		margin := int(float64(min(b.Dx(), b.Dy())) * params.Margin)
+
+		var pos image.Point
+		switch params.Position {
+		case "top-left":
+			pos = image.Pt(margin, margin)
+		case "top-right":
+			pos = image.Pt(b.Dx()-sb.Dx()-margin, margin)
+		case "bottom-left":
+			pos = image.Pt(margin, b.Dy()-sb.Dy()-margin)
+		case "bottom-right":
+			pos = image.Pt(b.Dx()-sb.Dx()-margin, b.Dy()-sb.Dy()-margin)
+		case "center":
+			pos = image.Pt((b.Dx()-sb.Dx())/2, (b.Dy()-sb.Dy())/2)
+		}
+		return overlay(img, scaled, pos, params.Opacity), nil
+	}, resolved, nil
+}
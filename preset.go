@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// imagePreset opisuje parametry przetwarzania pojedynczego obrazu
+type imagePreset struct {
+	Name      string
+	MaxWidth  uint
+	MaxHeight uint
+	Quality   float32
+	// Minimalne SSIM przy automatycznym podnoszeniu jakości (autoQuality)
+	MinSSIM float64
+}
+
+const defaultPresetName = "default"
+
+var imagePresets = map[string]imagePreset{
+	defaultPresetName: {
+		Name:      defaultPresetName,
+		MaxWidth:  2560,
+		MaxHeight: 1440,
+		Quality:   80,
+		MinSSIM:   0.97,
+	},
+}
+
+// getPreset zwraca preset o podanej nazwie (pusta nazwa = domyślny)
+func getPreset(name string) (imagePreset, error) {
+	if name == "" {
+		name = defaultPresetName
+	}
+	preset, ok := imagePresets[name]
+	if !ok {
+		return imagePreset{}, fmt.Errorf("unknown preset '%s'", name)
+	}
+	return preset, nil
+}
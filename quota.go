@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Limity poczekalni liczone są z rejestru staged_assets (WebP + zachowany oryginał,
+// także pliki w koszu - leżą w magazynie aż do TRASH_RETENTION) oraz z niedokończonych
+// uploadów tus, które i tak trafią do poczekalni.
+// Limit użytkownika ma pierwszeństwo przed limitem jego roli, brak obu = bez limitu.
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+type quotaLimits struct {
+	MaxBytes *int64 `json:"maxBytes"`
+	MaxFiles *int64 `json:"maxFiles"`
+	// Source mówi, skąd pochodzi limit: "user", "role" albo "none"
+	Source string `json:"source"`
+}
+
+type quotaUsage struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// quotaFor zwraca limity obowiązujące użytkownika
+func (cfg *apiConfig) quotaFor(ctx context.Context, userID int) (quotaLimits, error) {
+	userQuota, err := cfg.db.GetUserQuota(ctx, int64(userID))
+	if err == nil {
+		return quotaLimits{MaxBytes: userQuota.MaxBytes, MaxFiles: userQuota.MaxFiles, Source: "user"}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return quotaLimits{}, fmt.Errorf("couldn't get user quota: %w", err)
+	}
+
+	role, err := cfg.db.GetUserRoleById(ctx, int64(userID))
+	if err != nil {
+		return quotaLimits{}, fmt.Errorf("couldn't get user role: %w", err)
+	}
+	roleQuota, err := cfg.db.GetRoleQuota(ctx, role)
+	if err == nil {
+		return quotaLimits{MaxBytes: roleQuota.MaxBytes, MaxFiles: roleQuota.MaxFiles, Source: "role"}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return quotaLimits{}, fmt.Errorf("couldn't get role quota: %w", err)
+	}
+	return quotaLimits{Source: "none"}, nil
+}
+
+// stagingUsageFor zwraca zajęcie poczekalni użytkownika razem z trwającymi uploadami
+func (cfg *apiConfig) stagingUsageFor(ctx context.Context, userID int) (quotaUsage, error) {
+	staged, err := cfg.db.GetUserStagingUsage(ctx, int64(userID))
+	if err != nil {
+		return quotaUsage{}, fmt.Errorf("couldn't get staging usage: %w", err)
+	}
+	pending, err := cfg.db.GetPendingUploadUsage(ctx, int64(userID))
+	if err != nil {
+		return quotaUsage{}, fmt.Errorf("couldn't get pending uploads: %w", err)
+	}
+	return quotaUsage{
+		Files: staged.Files + pending.Files,
+		Bytes: staged.Bytes + pending.Bytes,
+	}, nil
+}
+
+// checkQuota sprawdza, czy files nowych plików o łącznym rozmiarze bytes zmieści się w limicie.
+// Rozmiar WebP nie jest znany przed przetworzeniem, więc liczymy tylko źródła.
+func (cfg *apiConfig) checkQuota(ctx context.Context, userID int, files int, bytes int64) error {
+	limits, err := cfg.quotaFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if limits.MaxBytes == nil && limits.MaxFiles == nil {
+		return nil
+	}
+	usage, err := cfg.stagingUsageFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if limits.MaxFiles != nil && usage.Files+int64(files) > *limits.MaxFiles {
+		return fmt.Errorf("%w: %d of %d staged files used, %d more requested",
+			errQuotaExceeded, usage.Files, *limits.MaxFiles, files)
+	}
+	if limits.MaxBytes != nil && usage.Bytes+bytes > *limits.MaxBytes {
+		return fmt.Errorf("%w: %d of %d staged bytes used, %d more requested",
+			errQuotaExceeded, usage.Bytes, *limits.MaxBytes, bytes)
+	}
+	return nil
+}
+
+// enforceQuota wywołuje checkQuota i przy przekroczeniu sam odpowiada klientowi.
+// Zwraca false, gdy przetwarzania nie należy zaczynać.
+func (cfg *apiConfig) enforceQuota(w http.ResponseWriter, r *http.Request, userID int, files int, bytes int64) bool {
+	err := cfg.checkQuota(r.Context(), userID, files, bytes)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, errQuotaExceeded) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error(), err)
+	} else {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check quota", err)
+	}
+	return false
+}
+
+// remainingQuotaBytes zwraca, ile bajtów zostało użytkownikowi w poczekalni (nil = bez limitu).
+// Służy do przerwania pobierania, zanim ściągniemy więcej, niż i tak odrzuci checkQuota.
+func (cfg *apiConfig) remainingQuotaBytes(ctx context.Context, userID int) (*int64, error) {
+	limits, err := cfg.quotaFor(ctx, userID)
+	if err != nil || limits.MaxBytes == nil {
+		return nil, err
+	}
+	usage, err := cfg.stagingUsageFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	remaining := max(*limits.MaxBytes-usage.Bytes, 0)
+	return &remaining, nil
+}
@@ -0,0 +1,43 @@
+-- name: CreateCollection :one
+INSERT INTO collections (user_id, name, description)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: GetCollectionForUser :one
+SELECT * FROM collections WHERE id = ? AND user_id = ?;
+
+-- name: ListCollectionsByUser :many
+SELECT
+    collections.*,
+    (SELECT COUNT(*) FROM collection_items i
+        JOIN staged_assets a ON a.filename = i.filename
+        WHERE i.collection_id = collections.id AND a.deleted_at IS NULL) AS item_count
+FROM collections
+WHERE collections.user_id = ?
+ORDER BY collections.name;
+
+-- name: UpdateCollection :one
+UPDATE collections
+SET name = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND user_id = ?
+RETURNING *;
+
+-- name: DeleteCollection :exec
+DELETE FROM collections WHERE id = ? AND user_id = ?;
+
+-- name: AddCollectionItem :exec
+INSERT OR IGNORE INTO collection_items (collection_id, filename, position)
+VALUES (
+    sqlc.arg(collection_id),
+    sqlc.arg(filename),
+    (SELECT COALESCE(MAX(position), 0) + 1 FROM collection_items WHERE collection_id = sqlc.arg(collection_id))
+);
+
+-- name: RemoveCollectionItem :exec
+DELETE FROM collection_items WHERE collection_id = ? AND filename = ?;
+
+-- name: ListCollectionAssets :many
+SELECT staged_assets.* FROM collection_items i
+JOIN staged_assets ON staged_assets.filename = i.filename
+WHERE i.collection_id = ? AND staged_assets.deleted_at IS NULL
+ORDER BY i.position;
@@ -0,0 +1,19 @@
+-- name: UpsertOriginal :one
+INSERT INTO originals (hash, media_type, size)
+VALUES (?, ?, ?)
+ON CONFLICT(hash) DO UPDATE SET last_used_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: GetOriginal :one
+SELECT * FROM originals WHERE hash = ?;
+
+-- name: ListExpiredOriginals :many
+SELECT * FROM originals
+WHERE last_used_at < ?
+ORDER BY last_used_at;
+
+-- name: UnlinkOriginalFromHistory :exec
+UPDATE upload_history SET original_hash = NULL WHERE original_hash = ?;
+
+-- name: DeleteOriginal :exec
+DELETE FROM originals WHERE hash = ?;
@@ -0,0 +1,17 @@
+-- name: GetPipeline :one
+SELECT * FROM pipelines WHERE destination = ?;
+
+-- name: ListPipelines :many
+SELECT * FROM pipelines ORDER BY destination;
+
+-- name: UpsertPipeline :one
+INSERT INTO pipelines (destination, steps, updated_by, updated_at)
+VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT (destination) DO UPDATE
+SET steps = excluded.steps,
+    updated_by = excluded.updated_by,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeletePipeline :exec
+DELETE FROM pipelines WHERE destination = ?;
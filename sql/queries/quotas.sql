@@ -0,0 +1,37 @@
+-- name: GetRoleQuota :one
+SELECT * FROM role_quotas WHERE role = ?;
+
+-- name: ListRoleQuotas :many
+SELECT * FROM role_quotas ORDER BY role;
+
+-- name: UpsertRoleQuota :one
+INSERT INTO role_quotas (role, max_bytes, max_files, updated_by, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT (role) DO UPDATE
+SET max_bytes = excluded.max_bytes,
+    max_files = excluded.max_files,
+    updated_by = excluded.updated_by,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteRoleQuota :exec
+DELETE FROM role_quotas WHERE role = ?;
+
+-- name: GetUserQuota :one
+SELECT * FROM user_quotas WHERE user_id = ?;
+
+-- name: ListUserQuotas :many
+SELECT * FROM user_quotas ORDER BY user_id;
+
+-- name: UpsertUserQuota :one
+INSERT INTO user_quotas (user_id, max_bytes, max_files, updated_by, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id) DO UPDATE
+SET max_bytes = excluded.max_bytes,
+    max_files = excluded.max_files,
+    updated_by = excluded.updated_by,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteUserQuota :exec
+DELETE FROM user_quotas WHERE user_id = ?;
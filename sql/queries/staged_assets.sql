@@ -0,0 +1,100 @@
+-- name: CreateStagedAsset :one
+INSERT INTO staged_assets (
+    filename, batch_id, user_id, original_name, original_size,
+    webp_size, width, height, preset, ssim, quality, title, caption,
+    media_type, original_file, destination, auto_quality, source_hash,
+    captured_at, camera_model, keywords
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetStagedAsset :one
+SELECT * FROM staged_assets WHERE filename = ?;
+
+-- name: GetMaxFilenameSuffix :one
+-- Najwyższy zajęty numer dla base: base.webp liczy się jako 1, base-N.webp jako N.
+-- Nazwy są slugami (a-z, 0-9, myślniki), więc base nie zawiera znaków specjalnych LIKE.
+-- Trafienia typu base-foo-2.webp dają 0 przy rzutowaniu i nie podbijają wyniku.
+SELECT CAST(COALESCE(MAX(CASE
+    WHEN filename = sqlc.arg(base) || '.webp' THEN 1
+    ELSE CAST(substr(filename, length(sqlc.arg(base)) + 2, length(filename) - length(sqlc.arg(base)) - 6) AS INTEGER)
+END), 0) AS INTEGER) AS suffix
+FROM staged_assets
+WHERE filename = sqlc.arg(base) || '.webp' OR filename LIKE sqlc.arg(base) || '-%.webp';
+
+-- name: GetStagedAssetForUser :one
+SELECT * FROM staged_assets WHERE filename = ? AND user_id = ? AND deleted_at IS NULL;
+
+-- name: ListStagedAssetsByUser :many
+SELECT * FROM staged_assets
+WHERE user_id = ? AND deleted_at IS NULL
+ORDER BY COALESCE(captured_at, created_at), filename;
+
+-- name: ListStagedAssetsByBatch :many
+SELECT * FROM staged_assets
+WHERE user_id = ? AND batch_id = ? AND deleted_at IS NULL
+ORDER BY COALESCE(captured_at, created_at), filename;
+
+-- name: UpdateStagedAssetMetadata :one
+UPDATE staged_assets
+SET title = ?, alt_text = ?, caption = ?, description = ?
+WHERE filename = ? AND user_id = ?
+RETURNING *;
+
+-- name: UpdateStagedAssetOutput :one
+UPDATE staged_assets
+SET webp_size = ?, width = ?, height = ?, ssim = ?, quality = ?, edits = ?
+WHERE filename = ? AND user_id = ?
+RETURNING *;
+
+-- name: DeleteStagedAsset :exec
+DELETE FROM staged_assets WHERE filename = ?;
+
+-- name: DeleteStagedAssetsByBatch :exec
+DELETE FROM staged_assets WHERE user_id = ? AND batch_id = ? AND deleted_at IS NULL;
+
+-- name: DeleteStagedAssetsByUser :exec
+DELETE FROM staged_assets WHERE user_id = ? AND deleted_at IS NULL;
+
+-- name: ListStagedAssetsCreatedBefore :many
+SELECT * FROM staged_assets
+WHERE created_at < ? AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: GetStagingUsage :one
+SELECT
+    COUNT(*) AS files,
+    CAST(COALESCE(SUM(webp_size), 0) AS INTEGER) AS webp_bytes,
+    CAST(COALESCE(SUM(original_size), 0) AS INTEGER) AS original_bytes
+FROM staged_assets;
+
+-- name: GetUserStagingUsage :one
+SELECT
+    COUNT(*) AS files,
+    CAST(COALESCE(SUM(webp_size + original_size), 0) AS INTEGER) AS bytes
+FROM staged_assets
+WHERE user_id = ?;
+
+-- name: TrashStagedAsset :exec
+UPDATE staged_assets
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE filename = ? AND user_id = ? AND deleted_at IS NULL;
+
+-- name: RestoreStagedAsset :one
+UPDATE staged_assets
+SET deleted_at = NULL
+WHERE filename = ? AND user_id = ? AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: GetTrashedAssetForUser :one
+SELECT * FROM staged_assets
+WHERE filename = ? AND user_id = ? AND deleted_at IS NOT NULL;
+
+-- name: ListTrashedAssetsByUser :many
+SELECT * FROM staged_assets
+WHERE user_id = ? AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, filename;
+
+-- name: ListTrashedAssetsDeletedBefore :many
+SELECT * FROM staged_assets
+WHERE deleted_at IS NOT NULL AND deleted_at < ?
+ORDER BY deleted_at;
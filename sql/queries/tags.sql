@@ -0,0 +1,64 @@
+-- name: UpsertTag :one
+INSERT INTO tags (name) VALUES (?)
+ON CONFLICT (name) DO UPDATE SET name = tags.name
+RETURNING *;
+
+-- name: GetTag :one
+SELECT * FROM tags WHERE id = ?;
+
+-- name: ListTags :many
+SELECT
+    tags.id,
+    tags.name,
+    tags.created_at,
+    (SELECT COUNT(*) FROM staged_asset_tags s
+        JOIN staged_assets a ON a.filename = s.filename
+        WHERE s.tag_id = tags.id AND a.deleted_at IS NULL) AS staged_count,
+    (SELECT COUNT(*) FROM upload_history_tags u WHERE u.tag_id = tags.id) AS published_count
+FROM tags
+ORDER BY tags.name;
+
+-- name: DeleteTag :exec
+DELETE FROM tags WHERE id = ?;
+
+-- name: ListTagsForStagedAsset :many
+SELECT tags.* FROM tags
+JOIN staged_asset_tags s ON s.tag_id = tags.id
+WHERE s.filename = ?
+ORDER BY tags.name;
+
+-- name: ListStagedAssetTagsByUser :many
+SELECT s.filename, tags.name FROM staged_asset_tags s
+JOIN tags ON tags.id = s.tag_id
+JOIN staged_assets a ON a.filename = s.filename
+WHERE a.user_id = ?
+ORDER BY tags.name;
+
+-- name: AddStagedAssetTag :exec
+INSERT OR IGNORE INTO staged_asset_tags (filename, tag_id) VALUES (?, ?);
+
+-- name: ClearStagedAssetTags :exec
+DELETE FROM staged_asset_tags WHERE filename = ?;
+
+-- name: CopyStagedAssetTagsToUpload :exec
+INSERT OR IGNORE INTO upload_history_tags (upload_id, tag_id)
+SELECT ?, tag_id FROM staged_asset_tags WHERE filename = ?;
+
+-- name: ListTagsForUpload :many
+SELECT tags.* FROM tags
+JOIN upload_history_tags u ON u.tag_id = tags.id
+WHERE u.upload_id = ?
+ORDER BY tags.name;
+
+-- name: ListUploadTagsByUser :many
+SELECT u.upload_id, tags.name FROM upload_history_tags u
+JOIN tags ON tags.id = u.tag_id
+JOIN upload_history h ON h.id = u.upload_id
+WHERE h.user_id = ?
+ORDER BY tags.name;
+
+-- name: AddUploadTag :exec
+INSERT OR IGNORE INTO upload_history_tags (upload_id, tag_id) VALUES (?, ?);
+
+-- name: ClearUploadTags :exec
+DELETE FROM upload_history_tags WHERE upload_id = ?;
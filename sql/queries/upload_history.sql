@@ -1,8 +1,10 @@
 -- name: CreateUploadHistory :one
 INSERT INTO upload_history (
     filename, original_size, webp_size, wordpress_id, 
-    wordpress_url, website_type, success, error_message, user_id
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    wordpress_url, website_type, success, error_message, user_id,
+    ssim, quality, title, alt_text, batch_id, original_hash,
+    caption, thumbnail_url
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: GetUploadHistory :many
@@ -13,4 +15,35 @@ LIMIT ? OFFSET ?;
 -- name: GetUploadHistoryByUser :many
 SELECT * FROM upload_history 
 WHERE user_id = ?
-ORDER BY created_at DESC;
\ No newline at end of file
+ORDER BY created_at DESC;
+
+-- name: GetPublishedBatch :many
+SELECT * FROM upload_history
+WHERE user_id = ? AND batch_id = ? AND success = 1
+ORDER BY id;
+
+-- name: GetPublishedForUser :one
+SELECT * FROM upload_history
+WHERE id = ? AND user_id = ? AND success = 1;
+
+-- name: ListPublishedByUser :many
+SELECT * FROM upload_history
+WHERE user_id = ? AND success = 1
+ORDER BY created_at DESC, id DESC
+LIMIT ? OFFSET ?;
+
+-- name: ListPublishedByUserAndTag :many
+SELECT upload_history.* FROM upload_history
+JOIN upload_history_tags u ON u.upload_id = upload_history.id
+JOIN tags ON tags.id = u.tag_id
+WHERE upload_history.user_id = ? AND upload_history.success = 1 AND tags.name = ?
+ORDER BY upload_history.created_at DESC, upload_history.id DESC
+LIMIT ? OFFSET ?;
+
+-- Wagi bm25 w kolejności kolumn: filename, title, alt_text, caption, tags, destination
+-- name: SearchMedia :many
+SELECT upload_history.* FROM media_search
+JOIN upload_history ON upload_history.id = media_search.rowid
+WHERE media_search MATCH sqlc.arg(query) AND upload_history.user_id = sqlc.arg(user_id)
+ORDER BY bm25(media_search, 1.0, 5.0, 2.0, 2.0, 4.0, 0.5), upload_history.id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
@@ -0,0 +1,31 @@
+-- name: CreateUpload :one
+INSERT INTO uploads (id, user_id, filename, content_type, length, settings, batch_id, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetUploadForUser :one
+SELECT * FROM uploads WHERE id = ? AND user_id = ?;
+
+-- name: AdvanceUploadOffset :one
+UPDATE uploads
+SET upload_offset = ?, expires_at = ?
+WHERE id = ? AND upload_offset = ?
+RETURNING *;
+
+-- name: CompleteUpload :exec
+UPDATE uploads
+SET completed_at = CURRENT_TIMESTAMP, result_filename = ?, error = ?
+WHERE id = ?;
+
+-- name: ListExpiredUploads :many
+SELECT * FROM uploads WHERE expires_at < ?;
+
+-- name: DeleteUpload :exec
+DELETE FROM uploads WHERE id = ?;
+
+-- name: GetPendingUploadUsage :one
+SELECT
+    COUNT(*) AS files,
+    CAST(COALESCE(SUM(length), 0) AS INTEGER) AS bytes
+FROM uploads
+WHERE user_id = ? AND completed_at IS NULL;
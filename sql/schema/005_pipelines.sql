@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE pipelines (
+    destination TEXT PRIMARY KEY,
+    steps TEXT NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE pipelines;
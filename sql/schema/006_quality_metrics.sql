@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE upload_history ADD COLUMN ssim REAL;
+ALTER TABLE upload_history ADD COLUMN quality REAL;
+
+-- +goose Down
+ALTER TABLE upload_history DROP COLUMN quality;
+ALTER TABLE upload_history DROP COLUMN ssim;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE staged_assets (
+    filename TEXT PRIMARY KEY,
+    batch_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    original_name TEXT NOT NULL,
+    original_size INTEGER NOT NULL,
+    webp_size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    preset TEXT NOT NULL,
+    ssim REAL NOT NULL,
+    quality REAL NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_staged_assets_user_batch ON staged_assets(user_id, batch_id);
+
+-- +goose Down
+DROP TABLE staged_assets;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE staged_assets ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- Historia zapamiętuje, z jakim tytułem i alt-em plik poszedł do WordPressa
+ALTER TABLE upload_history ADD COLUMN title TEXT;
+ALTER TABLE upload_history ADD COLUMN alt_text TEXT;
+
+-- +goose Down
+ALTER TABLE upload_history DROP COLUMN alt_text;
+ALTER TABLE upload_history DROP COLUMN title;
+
+ALTER TABLE staged_assets DROP COLUMN description;
+ALTER TABLE staged_assets DROP COLUMN caption;
+ALTER TABLE staged_assets DROP COLUMN alt_text;
+ALTER TABLE staged_assets DROP COLUMN title;
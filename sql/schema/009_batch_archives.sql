@@ -0,0 +1,14 @@
+-- +goose Up
+-- Oryginał zostaje w partii (ścieżka względem katalogu partii), żeby dało się go pobrać
+ALTER TABLE staged_assets ADD COLUMN media_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN original_file TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE upload_history ADD COLUMN batch_id TEXT;
+CREATE INDEX idx_upload_history_batch ON upload_history(user_id, batch_id);
+
+-- +goose Down
+DROP INDEX idx_upload_history_batch;
+ALTER TABLE upload_history DROP COLUMN batch_id;
+
+ALTER TABLE staged_assets DROP COLUMN original_file;
+ALTER TABLE staged_assets DROP COLUMN media_type;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Edycje (obrót/odbicie/kadr) są trzymane w postaci znormalizowanej i nakładane
+-- na oryginał przy każdym ponownym przetworzeniu. Destynacja i autoQuality
+-- pozwalają odtworzyć potok, którym plik był przetwarzany.
+ALTER TABLE staged_assets ADD COLUMN edits TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE staged_assets ADD COLUMN destination TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN auto_quality INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE staged_assets DROP COLUMN auto_quality;
+ALTER TABLE staged_assets DROP COLUMN destination;
+ALTER TABLE staged_assets DROP COLUMN edits;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Magazyn oryginałów adresowany treścią (sha256) - pozwala przetworzyć
+-- opublikowane pliki ponownie po zmianie presetu albo enkodera
+CREATE TABLE originals (
+    hash TEXT PRIMARY KEY,
+    media_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE staged_assets ADD COLUMN source_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE upload_history ADD COLUMN original_hash TEXT REFERENCES originals(hash) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE upload_history DROP COLUMN original_hash;
+ALTER TABLE staged_assets DROP COLUMN source_hash;
+DROP TABLE originals;
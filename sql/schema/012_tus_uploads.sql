@@ -0,0 +1,23 @@
+-- +goose Up
+-- Wznawialne uploady (protokół tus). Dane leżą w tempRoot/uploads/<id>,
+-- a upload_offset mówi, ile bajtów już dotarło.
+CREATE TABLE uploads (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    length INTEGER NOT NULL,
+    upload_offset INTEGER NOT NULL DEFAULT 0,
+    settings TEXT NOT NULL,
+    batch_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    result_filename TEXT,
+    error TEXT
+);
+
+CREATE INDEX idx_uploads_expires_at ON uploads(expires_at);
+
+-- +goose Down
+DROP TABLE uploads;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Limity poczekalni. NULL w kolumnie oznacza brak limitu w tym wymiarze.
+-- Wpis użytkownika w całości zastępuje limit jego roli.
+CREATE TABLE role_quotas (
+    role TEXT PRIMARY KEY,
+    max_bytes INTEGER,
+    max_files INTEGER,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE user_quotas (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    max_bytes INTEGER,
+    max_files INTEGER,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE user_quotas;
+DROP TABLE role_quotas;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Kosz poczekalni: usunięty plik zostaje w rejestrze z datą usunięcia,
+-- a jego pliki leżą w magazynie pod trash/<userID>/<batchID>/
+ALTER TABLE staged_assets ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX idx_staged_assets_deleted_at ON staged_assets(deleted_at);
+
+-- +goose Down
+DROP INDEX idx_staged_assets_deleted_at;
+ALTER TABLE staged_assets DROP COLUMN deleted_at;
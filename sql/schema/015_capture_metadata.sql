@@ -0,0 +1,11 @@
+-- +goose Up
+-- Metadane odczytane ze źródła: data wykonania zdjęcia (czas lokalny aparatu),
+-- model aparatu i słowa kluczowe z IPTC/XMP (tablica JSON)
+ALTER TABLE staged_assets ADD COLUMN captured_at DATETIME;
+ALTER TABLE staged_assets ADD COLUMN camera_model TEXT NOT NULL DEFAULT '';
+ALTER TABLE staged_assets ADD COLUMN keywords TEXT NOT NULL DEFAULT '[]';
+
+-- +goose Down
+ALTER TABLE staged_assets DROP COLUMN keywords;
+ALTER TABLE staged_assets DROP COLUMN camera_model;
+ALTER TABLE staged_assets DROP COLUMN captured_at;
@@ -0,0 +1,76 @@
+-- +goose Up
+-- Tagi są wspólne dla całego studia (styl, artysta, ...), kolekcje należą do użytkownika
+-- i grupują pliki z poczekalni niezależnie od partii.
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE staged_asset_tags (
+    filename TEXT NOT NULL REFERENCES staged_assets(filename) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (filename, tag_id)
+);
+
+CREATE TABLE upload_history_tags (
+    upload_id INTEGER NOT NULL REFERENCES upload_history(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (upload_id, tag_id)
+);
+
+CREATE INDEX idx_staged_asset_tags_tag ON staged_asset_tags(tag_id);
+CREATE INDEX idx_upload_history_tags_tag ON upload_history_tags(tag_id);
+
+CREATE TABLE collections (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE collection_items (
+    collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    filename TEXT NOT NULL REFERENCES staged_assets(filename) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, filename)
+);
+
+-- Połączenie nie włącza foreign_keys, więc kaskady robią wyzwalacze - plik usunięty
+-- z poczekalni (wysyłka, sprzątanie, janitor) znika też z tagów i kolekcji
+-- +goose StatementBegin
+CREATE TRIGGER staged_assets_delete_links AFTER DELETE ON staged_assets
+BEGIN
+    DELETE FROM staged_asset_tags WHERE filename = OLD.filename;
+    DELETE FROM collection_items WHERE filename = OLD.filename;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER tags_delete_links AFTER DELETE ON tags
+BEGIN
+    DELETE FROM staged_asset_tags WHERE tag_id = OLD.id;
+    DELETE FROM upload_history_tags WHERE tag_id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER collections_delete_items AFTER DELETE ON collections
+BEGIN
+    DELETE FROM collection_items WHERE collection_id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER collections_delete_items;
+DROP TRIGGER tags_delete_links;
+DROP TRIGGER staged_assets_delete_links;
+DROP TABLE collection_items;
+DROP TABLE collections;
+DROP TABLE upload_history_tags;
+DROP TABLE staged_asset_tags;
+DROP TABLE tags;
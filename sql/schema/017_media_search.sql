@@ -0,0 +1,77 @@
+-- +goose Up
+-- Podpis i miniatura z WordPressa trafiają do historii, żeby dało się je wyszukać i pokazać
+ALTER TABLE upload_history ADD COLUMN caption TEXT;
+ALTER TABLE upload_history ADD COLUMN thumbnail_url TEXT;
+
+-- Indeks pełnotekstowy opublikowanych plików; rowid = upload_history.id.
+-- Wymaga SQLite z FTS5 (go-sqlite3 budowany z tagiem sqlite_fts5).
+CREATE VIRTUAL TABLE media_search USING fts5(
+    filename,
+    title,
+    alt_text,
+    caption,
+    tags,
+    destination,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO media_search (rowid, filename, title, alt_text, caption, tags, destination)
+SELECT
+    h.id,
+    h.filename,
+    COALESCE(h.title, ''),
+    COALESCE(h.alt_text, ''),
+    COALESCE(h.caption, ''),
+    COALESCE((SELECT group_concat(t.name, ' ') FROM upload_history_tags u
+        JOIN tags t ON t.id = u.tag_id WHERE u.upload_id = h.id), ''),
+    h.website_type
+FROM upload_history h
+WHERE h.success = 1;
+
+-- Indeks jest utrzymywany wyzwalaczami - żaden handler nie musi o nim pamiętać
+-- +goose StatementBegin
+CREATE TRIGGER media_search_insert AFTER INSERT ON upload_history
+WHEN NEW.success = 1
+BEGIN
+    INSERT INTO media_search (rowid, filename, title, alt_text, caption, tags, destination)
+    VALUES (NEW.id, NEW.filename, COALESCE(NEW.title, ''), COALESCE(NEW.alt_text, ''),
+        COALESCE(NEW.caption, ''), '', NEW.website_type);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER media_search_delete AFTER DELETE ON upload_history
+BEGIN
+    DELETE FROM media_search WHERE rowid = OLD.id;
+    DELETE FROM upload_history_tags WHERE upload_id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER media_search_tag_insert AFTER INSERT ON upload_history_tags
+BEGIN
+    UPDATE media_search
+    SET tags = (SELECT group_concat(t.name, ' ') FROM upload_history_tags u
+        JOIN tags t ON t.id = u.tag_id WHERE u.upload_id = NEW.upload_id)
+    WHERE rowid = NEW.upload_id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER media_search_tag_delete AFTER DELETE ON upload_history_tags
+BEGIN
+    UPDATE media_search
+    SET tags = COALESCE((SELECT group_concat(t.name, ' ') FROM upload_history_tags u
+        JOIN tags t ON t.id = u.tag_id WHERE u.upload_id = OLD.upload_id), '')
+    WHERE rowid = OLD.upload_id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER media_search_tag_delete;
+DROP TRIGGER media_search_tag_insert;
+DROP TRIGGER media_search_delete;
+DROP TRIGGER media_search_insert;
+DROP TABLE media_search;
+ALTER TABLE upload_history DROP COLUMN thumbnail_url;
+ALTER TABLE upload_history DROP COLUMN caption;
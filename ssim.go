@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/chai2010/webp"
+)
+
+// SSIM liczone na luminancji w oknach 8x8 przesuwanych co 4 piksele
+const (
+	ssimWindow = 8
+	ssimStride = 4
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+)
+
+// computeSSIM porównuje dwa obrazy o tych samych wymiarach (1.0 = identyczne)
+func computeSSIM(a, b image.Image) (float64, error) {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return 0, fmt.Errorf("image sizes differ: %dx%d vs %dx%d", ab.Dx(), ab.Dy(), bb.Dx(), bb.Dy())
+	}
+	width, height := ab.Dx(), ab.Dy()
+	la, lb := luma(a), luma(b)
+
+	if width < ssimWindow || height < ssimWindow {
+		return ssimBlock(la, lb, width, 0, 0, width, height), nil
+	}
+
+	var sum float64
+	var n int
+	for y := 0; y+ssimWindow <= height; y += ssimStride {
+		for x := 0; x+ssimWindow <= width; x += ssimStride {
+			sum += ssimBlock(la, lb, width, x, y, ssimWindow, ssimWindow)
+			n++
+		}
+	}
+	return sum / float64(n), nil
+}
+
+func ssimBlock(a, b []float64, stride, x0, y0, w, h int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			va, vb := a[y*stride+x], b[y*stride+x]
+			sumA += va
+			sumB += vb
+			sumAA += va * va
+			sumBB += vb * vb
+			sumAB += va * vb
+		}
+	}
+	n := float64(w * h)
+	meanA, meanB := sumA/n, sumB/n
+	varA := sumAA/n - meanA*meanA
+	varB := sumBB/n - meanB*meanB
+	cov := sumAB/n - meanA*meanB
+
+	return ((2*meanA*meanB + ssimC1) * (2*cov + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
+
+// luma zwraca jasność pikseli (BT.601) w skali 0-255
+func luma(img image.Image) []float64 {
+	b := img.Bounds()
+	out := make([]float64, b.Dx()*b.Dy())
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out[i] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 257
+			i++
+		}
+	}
+	return out
+}
+
+// measureWebP dekoduje zapisany plik WebP i porównuje go z obrazem przed kodowaniem
+func measureWebP(reference image.Image, path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't open WebP file: %w", err)
+	}
+	defer file.Close()
+
+	decoded, err := webp.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't decode WebP file: %w", err)
+	}
+	return computeSSIM(reference, decoded)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Import z adresów URL nie może służyć do odpytywania sieci wewnętrznej (SSRF).
+// Host rozwiązujemy sami i łączymy się dokładnie z sprawdzonym adresem IP,
+// więc podmiana rekordu DNS między sprawdzeniem a połączeniem niczego nie da.
+// Przekierowania przechodzą przez ten sam dialer.
+
+var errForbiddenAddress = errors.New("address is not allowed")
+
+// Zakresy, których nie obejmują metody net.IP, a które też nie są publiczne
+var extraBlockedNets = mustParseCIDRs(
+	"100.64.0.0/10", // CGNAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // testy wydajności
+	"64:ff9b::/96",  // NAT64 - może prowadzić do adresów IPv4 z sieci prywatnej
+)
+
+// importAllowlist to wyjątki od blokady: całe sieci (CIDR lub pojedyncze IP) albo nazwy hostów
+type importAllowlist struct {
+	nets  []*net.IPNet
+	hosts map[string]bool
+}
+
+// parseImportAllowlist czyta listę rozdzieloną przecinkami, np. "127.0.0.1,10.0.0.0/8,minio.local"
+func parseImportAllowlist(value string) (importAllowlist, error) {
+	list := importAllowlist{hosts: map[string]bool{}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			list.nets = append(list.nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			list.nets = append(list.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if strings.ContainsAny(entry, "/:") {
+			return importAllowlist{}, fmt.Errorf("invalid entry '%s'", entry)
+		}
+		list.hosts[strings.ToLower(entry)] = true
+	}
+	return list, nil
+}
+
+func (a importAllowlist) allowsIP(ip net.IP) bool {
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicIP odrzuca loopback, sieci prywatne, link-local, multicast i adresy specjalne
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	if ip.Equal(net.IPv4bcast) {
+		return false
+	}
+	for _, n := range extraBlockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newImportClient zwraca klienta HTTP, który łączy się tylko z publicznymi adresami
+// (albo z dozwolonymi przez allowlistę) i przerywa pobieranie po timeout
+func newImportClient(allowlist importAllowlist, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		hostAllowed := allowlist.hosts[strings.ToLower(host)]
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error = fmt.Errorf("%w: %s has no addresses", errForbiddenAddress, host)
+		for _, ip := range ips {
+			if !hostAllowed && !isPublicIP(ip.IP) && !allowlist.allowsIP(ip.IP) {
+				lastErr = fmt.Errorf("%w: %s resolves to %s", errForbiddenAddress, host, ip.IP)
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Proxy z otoczenia ominąłby sprawdzanie adresów
+			Proxy:                 nil,
+			DialContext:           dial,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("stopped after 5 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme '%s'", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
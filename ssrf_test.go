@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestParseImportAllowlist(t *testing.T) {
+	list, err := parseImportAllowlist(" 127.0.0.1, 10.0.0.0/8,MinIO.local,,::1 ")
+	if err != nil {
+		t.Fatalf("parseImportAllowlist: %v", err)
+	}
+	for _, ip := range []string{"127.0.0.1", "10.20.30.40", "::1"} {
+		if !list.allowsIP(net.ParseIP(ip)) {
+			t.Errorf("%s should be allowed", ip)
+		}
+	}
+	for _, ip := range []string{"127.0.0.2", "192.168.0.1"} {
+		if list.allowsIP(net.ParseIP(ip)) {
+			t.Errorf("%s should not be allowed", ip)
+		}
+	}
+	if !list.hosts["minio.local"] {
+		t.Errorf("host names should be matched case-insensitively, got %v", list.hosts)
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "http://example.com", "host:80"} {
+		if _, err := parseImportAllowlist(value); err == nil {
+			t.Errorf("parseImportAllowlist(%q) should fail", value)
+		}
+	}
+}
+
+// newTestImageServer serwuje kilka bajtów jako image/png - do testów pobierania
+// treść nie musi być poprawnym obrazem
+func newTestImageServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestImportClientBlocksLoopback(t *testing.T) {
+	srv := newTestImageServer(t, "png")
+
+	client := newImportClient(importAllowlist{}, 5*time.Second)
+	_, err := client.Get(srv.URL)
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Fatalf("expected errForbiddenAddress, got %v", err)
+	}
+}
+
+func TestImportClientAllowsAllowlistedLoopback(t *testing.T) {
+	srv := newTestImageServer(t, "png")
+
+	allowlist, err := parseImportAllowlist("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newImportClient(allowlist, 5*time.Second)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("allowlisted address should be reachable: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestImportClientBlocksRedirectToPrivateAddress(t *testing.T) {
+	internal := newTestImageServer(t, "secret")
+	// Serwer przekierowujący jest dozwolony tylko po nazwie hosta, więc
+	// przekierowanie na adres IP z loopbacku musi zostać zablokowane przy połączeniu
+	redirector := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	t.Cleanup(redirector.Close)
+
+	u, err := url.Parse(redirector.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := parseImportAllowlist("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newImportClient(allowlist, 5*time.Second)
+	_, err = client.Get("http://localhost:" + u.Port())
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Fatalf("expected errForbiddenAddress after redirect, got %v", err)
+	}
+}
+
+func TestFetchImportSourceSizeLimit(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	srv := newTestImageServer(t, body)
+	// Bez Content-Length limit musi zadziałać w trakcie czytania treści
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(body[:50]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[50:]))
+	}))
+	t.Cleanup(chunked.Close)
+
+	cfg := &apiConfig{tempRoot: t.TempDir()}
+	if err := os.MkdirAll(cfg.scratchDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := parseImportAllowlist("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newImportClient(allowlist, 5*time.Second)
+
+	for _, target := range []string{srv.URL, chunked.URL} {
+		_, err := cfg.fetchImportSource(context.Background(), client, target+"/photo.png", 99)
+		if !errors.Is(err, errImportTooLarge) {
+			t.Errorf("%s: expected errImportTooLarge, got %v", target, err)
+		}
+
+		source, err := cfg.fetchImportSource(context.Background(), client, target+"/photo.png", 100)
+		if err != nil {
+			t.Fatalf("%s: file at the limit should be accepted: %v", target, err)
+		}
+		if source.Size != 100 || source.Name != "photo.png" {
+			t.Errorf("%s: got size %d, name %q", target, source.Size, source.Name)
+		}
+		os.Remove(source.path)
+	}
+
+	entries, err := os.ReadDir(cfg.scratchDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("rejected downloads should not leave scratch files, found %d", len(entries))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Poczekalnia jest podzielona na użytkowników i partie (batch). Klucze w magazynie:
+// <userID>/<batchID>/.batch - znacznik istnienia partii
+// <userID>/<batchID>/<plik>.webp
+// <userID>/<batchID>/originals/<plik>.<rozszerzenie oryginału>
+// trash/<userID>/<batchID>/... - kosz, patrz trash.go
+// Dzięki temu wysyłka i sprzątanie jednej osoby nie ruszają plików innych.
+
+const (
+	originalsDirName = "originals"
+	batchMarker      = ".batch"
+)
+
+var (
+	errBatchNotFound      = errors.New("batch not found")
+	errStagedFileNotFound = errors.New("staged file not found")
+)
+
+func userStagingPrefix(userID int) string {
+	return strconv.Itoa(userID) + "/"
+}
+
+func batchPrefix(userID int, batchID string) string {
+	return userStagingPrefix(userID) + batchID + "/"
+}
+
+// stagingKey zwraca klucz pliku partii; name może zawierać podkatalog (originals/...)
+func stagingKey(userID int, batchID, name string) string {
+	return batchPrefix(userID, batchID) + name
+}
+
+// scratchDir to lokalny katalog roboczy - enkoder i dekodery potrzebują zwykłych plików,
+// niezależnie od tego, gdzie leży poczekalnia
+func (cfg *apiConfig) scratchDir() string {
+	return filepath.Join(cfg.tempRoot, "scratch")
+}
+
+// scratchPath zwraca unikalną ścieżkę pliku roboczego
+func (cfg *apiConfig) scratchPath() string {
+	return filepath.Join(cfg.scratchDir(), uuid.New().String()+".tmp")
+}
+
+// createBatch zakłada nową partię użytkownika i zwraca jej ID
+func (cfg *apiConfig) createBatch(ctx context.Context, userID int) (string, error) {
+	batchID := uuid.New().String()
+	err := cfg.staging.Put(ctx, stagingKey(userID, batchID, batchMarker), strings.NewReader(""), 0, "")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create batch: %w", err)
+	}
+	return batchID, nil
+}
+
+// openBatch sprawdza, czy partia istnieje i należy do użytkownika
+func (cfg *apiConfig) openBatch(ctx context.Context, userID int, batchID string) error {
+	// ID partii trafia do klucza - przyjmujemy wyłącznie UUID
+	if _, err := uuid.Parse(batchID); err != nil {
+		return errBatchNotFound
+	}
+	_, err := cfg.staging.Stat(ctx, stagingKey(userID, batchID, batchMarker))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("couldn't check batch: %w", err)
+	}
+	// Partie sprzed wprowadzenia znacznika rozpoznajemy po samych plikach
+	objects, err := cfg.staging.List(ctx, batchPrefix(userID, batchID))
+	if err != nil {
+		return fmt.Errorf("couldn't check batch: %w", err)
+	}
+	if len(objects) == 0 {
+		return errBatchNotFound
+	}
+	return nil
+}
+
+// findStagedAsset odnajduje plik użytkownika przez rejestr staged_assets
+// i zwraca jego wpis razem z kluczem pliku WebP w poczekalni
+func (cfg *apiConfig) findStagedAsset(ctx context.Context, userID int, filename string) (database.StagedAsset, string, error) {
+	if filename == "" || filename != filepath.Base(filename) || filename == ".." {
+		return database.StagedAsset{}, "", errStagedFileNotFound
+	}
+	asset, err := cfg.db.GetStagedAssetForUser(ctx, database.GetStagedAssetForUserParams{
+		Filename: filename,
+		UserID:   int64(userID),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.StagedAsset{}, "", errStagedFileNotFound
+		}
+		return database.StagedAsset{}, "", fmt.Errorf("couldn't get staged asset: %w", err)
+	}
+	return asset, stagingKey(userID, asset.BatchID, asset.Filename), nil
+}
+
+// putStagedFile przenosi plik roboczy do poczekalni pod podany klucz
+func (cfg *apiConfig) putStagedFile(ctx context.Context, key, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("couldn't open file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't stat file: %w", err)
+	}
+	if err := cfg.staging.Put(ctx, key, file, info.Size(), contentTypeFor(key)); err != nil {
+		return fmt.Errorf("couldn't store staged file: %w", err)
+	}
+	return nil
+}
+
+// keepOriginal kopiuje źródło do originals partii i zwraca ścieżkę względem partii
+func (cfg *apiConfig) keepOriginal(ctx context.Context, file io.ReadSeeker, size int64, userID int, batchID, filename, sourceName string) (string, error) {
+	rel := path.Join(originalsDirName, strings.TrimSuffix(filename, ".webp")+strings.ToLower(filepath.Ext(sourceName)))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("couldn't rewind file: %w", err)
+	}
+	if err := cfg.staging.Put(ctx, stagingKey(userID, batchID, rel), file, size, ""); err != nil {
+		return "", fmt.Errorf("couldn't keep original: %w", err)
+	}
+	return rel, nil
+}
+
+// fetchToScratch pobiera obiekt do lokalnego pliku roboczego, który znika po zamknięciu
+func (cfg *apiConfig) fetchToScratch(ctx context.Context, store storage.Storage, key string) (*tempFile, error) {
+	rc, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	file, err := os.Create(cfg.scratchPath())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create scratch file: %w", err)
+	}
+	tmp := &tempFile{File: file}
+	if _, err := io.Copy(file, rc); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("couldn't download %s: %w", key, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("couldn't rewind file: %w", err)
+	}
+	return tmp, nil
+}
+
+// removeBatch usuwa partię razem z jej wpisami w rejestrze staged_assets
+func (cfg *apiConfig) removeBatch(ctx context.Context, userID int, batchID string) error {
+	err := cfg.db.DeleteStagedAssetsByBatch(ctx, database.DeleteStagedAssetsByBatchParams{
+		UserID:  int64(userID),
+		BatchID: batchID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't delete staged assets: %w", err)
+	}
+	return storage.DeletePrefix(ctx, cfg.staging, batchPrefix(userID, batchID))
+}
+
+// removeUserStaging usuwa wszystkie partie użytkownika
+func (cfg *apiConfig) removeUserStaging(ctx context.Context, userID int) error {
+	if err := cfg.db.DeleteStagedAssetsByUser(ctx, int64(userID)); err != nil {
+		return fmt.Errorf("couldn't delete staged assets: %w", err)
+	}
+	return storage.DeletePrefix(ctx, cfg.staging, userStagingPrefix(userID))
+}
+
+// stagingURL zwraca adres podglądu pliku z poczekalni
+func stagingURL(userID int, batchID, filename string) string {
+	return fmt.Sprintf("/staging/%d/%s/%s", userID, batchID, filename)
+}
+
+// stagingFileHandler serwuje pojedyncze pliki z poczekalni (bez listowania katalogów).
+// Adres zawiera losowe UUID partii, więc podglądy działają w <img> bez nagłówka Authorization.
+func (cfg *apiConfig) stagingFileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	batchID := r.PathValue("batchID")
+	filename := r.PathValue("filename")
+	if err != nil || filepath.Ext(filename) != ".webp" || filename != filepath.Base(filename) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := cfg.openBatch(r.Context(), userID, batchID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Edycja podmienia plik pod tym samym adresem - przeglądarka ma go rewalidować
+	w.Header().Set("Cache-Control", "private, no-cache")
+	serveObject(w, r, cfg.staging, stagingKey(userID, batchID, filename))
+}
+
+// serveObject wysyła obiekt z magazynu. Lokalne pliki obsługują Range i If-Modified-Since
+// przez http.ServeContent, obiekty z S3 są przepisywane strumieniowo.
+func serveObject(w http.ResponseWriter, r *http.Request, store storage.Storage, key string) {
+	rc, info, err := store.Get(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't read file", err)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer rc.Close()
+
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, rs)
+		return
+	}
+	if ct := contentTypeFor(key); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, rc)
+	}
+}
+
+func contentTypeFor(key string) string {
+	return mime.TypeByExtension(strings.ToLower(path.Ext(key)))
+}
+
+// stagedBatch to partia znaleziona w magazynie (po znaczniku .batch)
+type stagedBatch struct {
+	UserID    int
+	BatchID   string
+	CreatedAt time.Time
+}
+
+// listStagedBatches zwraca wszystkie partie w poczekalni
+func (cfg *apiConfig) listStagedBatches(ctx context.Context) ([]stagedBatch, error) {
+	objects, err := cfg.staging.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var batches []stagedBatch
+	for _, obj := range objects {
+		parts := strings.Split(obj.Key, "/")
+		if len(parts) != 3 || parts[2] != batchMarker {
+			continue
+		}
+		userID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		batches = append(batches, stagedBatch{UserID: userID, BatchID: parts[1], CreatedAt: obj.ModTime})
+	}
+	return batches, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+)
+
+// Tagi są wspólne dla wszystkich użytkowników - nazwa jest unikalna bez względu
+// na wielkość liter, a zostaje w takiej formie, w jakiej ktoś ją wpisał pierwszy.
+// Przy wysyłce tagi pliku z poczekalni przechodzą na jego wpis w historii.
+
+const (
+	maxTagLength    = 50
+	maxTagsPerImage = 30
+)
+
+// normalizeTags przycina nazwy, skleja wielokrotne spacje i usuwa powtórzenia
+func normalizeTags(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return nil, fmt.Errorf("tag '%s' is longer than %d characters", name, maxTagLength)
+		}
+		seen[strings.ToLower(name)] = true
+		tags = append(tags, name)
+	}
+	if len(tags) > maxTagsPerImage {
+		return nil, fmt.Errorf("%d tags provided, limit is %d", len(tags), maxTagsPerImage)
+	}
+	return tags, nil
+}
+
+// resolveTags zakłada brakujące tagi i zwraca wszystkie
+func (cfg *apiConfig) resolveTags(ctx context.Context, names []string) ([]database.Tag, error) {
+	tags := make([]database.Tag, 0, len(names))
+	for _, name := range names {
+		tag, err := cfg.db.UpsertTag(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't save tag '%s': %w", name, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// setStagedAssetTags zastępuje tagi pliku z poczekalni podaną listą
+func (cfg *apiConfig) setStagedAssetTags(ctx context.Context, filename string, names []string) error {
+	tags, err := cfg.resolveTags(ctx, names)
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.ClearStagedAssetTags(ctx, filename); err != nil {
+		return fmt.Errorf("couldn't clear tags: %w", err)
+	}
+	for _, tag := range tags {
+		err := cfg.db.AddStagedAssetTag(ctx, database.AddStagedAssetTagParams{
+			Filename: filename,
+			TagID:    tag.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't add tag '%s': %w", tag.Name, err)
+		}
+	}
+	return nil
+}
+
+// setUploadTags zastępuje tagi opublikowanego pliku podaną listą
+func (cfg *apiConfig) setUploadTags(ctx context.Context, uploadID int64, names []string) error {
+	tags, err := cfg.resolveTags(ctx, names)
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.ClearUploadTags(ctx, uploadID); err != nil {
+		return fmt.Errorf("couldn't clear tags: %w", err)
+	}
+	for _, tag := range tags {
+		err := cfg.db.AddUploadTag(ctx, database.AddUploadTagParams{
+			UploadID: uploadID,
+			TagID:    tag.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't add tag '%s': %w", tag.Name, err)
+		}
+	}
+	return nil
+}
+
+// stagedTagsByUser zwraca tagi wszystkich plików użytkownika (także z kosza) - jedno
+// zapytanie zamiast osobnego dla każdego pliku na liście
+func (cfg *apiConfig) stagedTagsByUser(ctx context.Context, userID int) (map[string][]string, error) {
+	rows, err := cfg.db.ListStagedAssetTagsByUser(ctx, int64(userID))
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string][]string{}
+	for _, row := range rows {
+		tags[row.Filename] = append(tags[row.Filename], row.Name)
+	}
+	return tags, nil
+}
+
+// stagedImage buduje odpowiedź dla pojedynczego pliku razem z jego tagami
+func (cfg *apiConfig) stagedImage(ctx context.Context, asset database.StagedAsset) StagedImage {
+	image := stagedImageFromRow(asset)
+	tags, err := cfg.db.ListTagsForStagedAsset(ctx, asset.Filename)
+	if err != nil {
+		return image
+	}
+	image.Tags = tagNames(tags)
+	return image
+}
+
+func tagNames(tags []database.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// hasTag sprawdza, czy lista zawiera tag (bez względu na wielkość liter)
+func hasTag(tags []string, name string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(tag, name) {
+			return true
+		}
+	}
+	return false
+}
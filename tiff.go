@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Minimalny parser struktury TIFF - wystarczy do odczytu bloków EXIF
+
+const (
+	tiffTypeByte     = 1
+	tiffTypeASCII    = 2
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+	tiffTypeUndef    = 7
+)
+
+const (
+	tagCompression      = 0x0103
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagStripOffsets     = 0x0111
+	tagOrientation      = 0x0112
+	tagStripByteCounts  = 0x0117
+	tagSubIFDs          = 0x014A
+	tagJPEGOffset       = 0x0201
+	tagJPEGLength       = 0x0202
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+type tiffEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	raw   [4]byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// parseTIFF sprawdza nagłówek i zwraca czytnik oraz offset pierwszego IFD
+func parseTIFF(data []byte) (*tiffReader, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("tiff header too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, fmt.Errorf("invalid tiff byte order")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, 0, fmt.Errorf("invalid tiff magic number")
+	}
+	return &tiffReader{data: data, order: order}, order.Uint32(data[4:8]), nil
+}
+
+// readIFD zwraca wpisy katalogu oraz offset następnego IFD (0 = koniec)
+func (t *tiffReader) readIFD(offset uint32) ([]tiffEntry, uint32, error) {
+	if offset == 0 || int64(offset)+2 > int64(len(t.data)) {
+		return nil, 0, fmt.Errorf("ifd offset %d out of range", offset)
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	end := start + count*12
+	if end+4 > len(t.data) {
+		return nil, 0, fmt.Errorf("ifd at %d is truncated", offset)
+	}
+
+	entries := make([]tiffEntry, count)
+	for i := range entries {
+		b := t.data[start+i*12:]
+		entries[i] = tiffEntry{
+			Tag:   t.order.Uint16(b[0:2]),
+			Type:  t.order.Uint16(b[2:4]),
+			Count: t.order.Uint32(b[4:8]),
+		}
+		copy(entries[i].raw[:], b[8:12])
+	}
+	return entries, t.order.Uint32(t.data[end:]), nil
+}
+
+func findTag(entries []tiffEntry, tag uint16) (tiffEntry, bool) {
+	for _, e := range entries {
+		if e.Tag == tag {
+			return e, true
+		}
+	}
+	return tiffEntry{}, false
+}
+
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case tiffTypeByte, tiffTypeASCII, tiffTypeUndef:
+		return 1
+	case tiffTypeShort:
+		return 2
+	case tiffTypeLong:
+		return 4
+	case tiffTypeRational:
+		return 8
+	}
+	return 0
+}
+
+// valueBytes zwraca dane wpisu - zapisane w samym wpisie lub pod offsetem
+func (t *tiffReader) valueBytes(e tiffEntry) ([]byte, error) {
+	size := int64(tiffTypeSize(e.Type)) * int64(e.Count)
+	if size == 0 {
+		return nil, fmt.Errorf("unsupported tiff type %d for tag 0x%04x", e.Type, e.Tag)
+	}
+	if size <= 4 {
+		return e.raw[:size], nil
+	}
+	offset := int64(t.order.Uint32(e.raw[:]))
+	if offset+size > int64(len(t.data)) {
+		return nil, fmt.Errorf("value of tag 0x%04x out of range", e.Tag)
+	}
+	return t.data[offset : offset+size], nil
+}
+
+// uints odczytuje wartości typu BYTE, SHORT lub LONG
+func (t *tiffReader) uints(e tiffEntry) ([]uint32, error) {
+	b, err := t.valueBytes(e)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]uint32, e.Count)
+	for i := range values {
+		switch e.Type {
+		case tiffTypeByte, tiffTypeUndef:
+			values[i] = uint32(b[i])
+		case tiffTypeShort:
+			values[i] = uint32(t.order.Uint16(b[i*2:]))
+		case tiffTypeLong:
+			values[i] = t.order.Uint32(b[i*4:])
+		default:
+			return nil, fmt.Errorf("tag 0x%04x is not an integer", e.Tag)
+		}
+	}
+	return values, nil
+}
+
+func (t *tiffReader) uint(e tiffEntry) (uint32, error) {
+	values, err := t.uints(e)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("tag 0x%04x has no values", e.Tag)
+	}
+	return values[0], nil
+}
+
+// string odczytuje wartość typu ASCII (bez końcowego NUL i spacji)
+func (t *tiffReader) string(e tiffEntry) (string, error) {
+	if e.Type != tiffTypeASCII {
+		return "", fmt.Errorf("tag 0x%04x is not a string", e.Tag)
+	}
+	b, err := t.valueBytes(e)
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Operacje geometryczne i filtry używane przez kroki potoku
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	return cloneNRGBA(img)
+}
+
+// cloneNRGBA zawsze tworzy nową kopię - do operacji modyfikujących piksele w miejscu
+func cloneNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// transformPixels przepisuje piksele według funkcji mapującej współrzędne wyjścia na wejście
+func transformPixels(img image.Image, width, height int, source func(x, y int) (int, int)) *image.NRGBA {
+	src := toNRGBA(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := source(x, y)
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+func rotate90(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return transformPixels(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+}
+
+func rotate180(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return transformPixels(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+}
+
+func rotate270(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return transformPixels(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+}
+
+func flipHorizontal(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return transformPixels(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+func flipVertical(img image.Image) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return transformPixels(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+// applyOrientation obraca obraz zgodnie z tagiem EXIF Orientation (1-8)
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipHorizontal(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipVertical(img)
+	case 5:
+		return flipHorizontal(rotate90(img))
+	case 6:
+		return rotate90(img)
+	case 7:
+		return flipHorizontal(rotate270(img))
+	case 8:
+		return rotate270(img)
+	}
+	return img
+}
+
+// cropRect wycina prostokąt (współrzędne względem początku obrazu)
+func cropRect(img image.Image, rect image.Rectangle) *image.NRGBA {
+	b := img.Bounds()
+	rect = rect.Add(b.Min).Intersect(b)
+	dst := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// cropToAspect przycina obraz do proporcji ratio (szerokość/wysokość)
+// względem wskazanego punktu zaczepienia
+func cropToAspect(img image.Image, ratio float64, gravity string) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	cw, ch := w, h
+	if float64(w)/float64(h) > ratio {
+		cw = int(float64(h)*ratio + 0.5)
+	} else {
+		ch = int(float64(w)/ratio + 0.5)
+	}
+
+	x, y := (w-cw)/2, (h-ch)/2
+	switch gravity {
+	case "top":
+		y = 0
+	case "bottom":
+		y = h - ch
+	case "left":
+		x = 0
+	case "right":
+		x = w - cw
+	}
+	return cropRect(img, image.Rect(x, y, x+cw, y+ch))
+}
+
+// boxBlur rozmywa obraz filtrem pudełkowym o promieniu radius (osobno w poziomie i pionie)
+func boxBlur(src *image.NRGBA, radius int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	tmp := image.NewNRGBA(src.Rect)
+	dst := image.NewNRGBA(src.Rect)
+	blurPass(src, tmp, w, h, radius, true)
+	blurPass(tmp, dst, w, h, radius, false)
+	return dst
+}
+
+func blurPass(src, dst *image.NRGBA, w, h, radius int, horizontal bool) {
+	lines, length := h, w
+	if !horizontal {
+		lines, length = w, h
+	}
+	offset := func(line, i int) int {
+		if horizontal {
+			return src.PixOffset(i, line)
+		}
+		return src.PixOffset(line, i)
+	}
+	for line := 0; line < lines; line++ {
+		for i := 0; i < length; i++ {
+			var sum [4]int
+			n := 0
+			for k := i - radius; k <= i+radius; k++ {
+				if k < 0 || k >= length {
+					continue
+				}
+				o := offset(line, k)
+				for c := 0; c < 4; c++ {
+					sum[c] += int(src.Pix[o+c])
+				}
+				n++
+			}
+			o := offset(line, i)
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+}
+
+// sharpen wyostrza obraz maską wyostrzającą (unsharp mask)
+func sharpen(img image.Image, amount float64, radius int) *image.NRGBA {
+	src := toNRGBA(img)
+	blurred := boxBlur(src, radius)
+	dst := image.NewNRGBA(src.Rect)
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			orig := float64(src.Pix[i+c])
+			v := orig + amount*(orig-float64(blurred.Pix[i+c]))
+			dst.Pix[i+c] = clampUint8(v)
+		}
+		dst.Pix[i+3] = src.Pix[i+3]
+	}
+	return dst
+}
+
+func clampUint8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// overlay nakłada znak wodny w podanej pozycji z zadaną przezroczystością
+func overlay(img image.Image, mark image.Image, position image.Point, opacity float64) *image.NRGBA {
+	dst := cloneNRGBA(img)
+	mask := image.NewUniform(color.Alpha{A: clampUint8(opacity * 255)})
+	r := mark.Bounds().Sub(mark.Bounds().Min).Add(position)
+	draw.DrawMask(dst, r, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+	return dst
+}
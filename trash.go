@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Pepegakac123/goCmsAssistant/internal/database"
+	"github.com/Pepegakac123/goCmsAssistant/internal/storage"
+)
+
+// Usunięte pliki poczekalni trafiają do kosza: wpis w staged_assets dostaje deleted_at,
+// a pliki przenosimy pod trash/<userID>/<batchID>/. Kosz przeżywa wysyłkę i sprzątanie
+// partii, więc plik da się przywrócić nawet wtedy, gdy jego partii już nie ma.
+// Janitor usuwa pliki leżące w koszu dłużej niż TRASH_RETENTION.
+
+const (
+	trashPrefix           = "trash/"
+	defaultTrashRetention = 7 * 24 * time.Hour
+)
+
+func trashKey(userID int, batchID, name string) string {
+	return trashPrefix + stagingKey(userID, batchID, name)
+}
+
+// trashURL zwraca adres podglądu pliku z kosza
+func trashURL(userID int, batchID, filename string) string {
+	return fmt.Sprintf("/staging/trash/%d/%s/%s", userID, batchID, filename)
+}
+
+// moveObject przenosi obiekt w obrębie magazynu (kopia + usunięcie źródła)
+func moveObject(ctx context.Context, store storage.Storage, from, to string) error {
+	rc, info, err := store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := store.Put(ctx, to, rc, info.Size, contentTypeFor(to)); err != nil {
+		return err
+	}
+	return store.Delete(ctx, from)
+}
+
+// assetKeys zwraca nazwy plików wpisu względem partii (WebP i zachowany oryginał)
+func assetKeys(asset database.StagedAsset) []string {
+	names := []string{asset.Filename}
+	if asset.OriginalFile != "" {
+		names = append(names, asset.OriginalFile)
+	}
+	return names
+}
+
+// trashStagedAsset przenosi pliki wpisu do kosza i oznacza go jako usunięty
+func (cfg *apiConfig) trashStagedAsset(ctx context.Context, asset database.StagedAsset) error {
+	userID := int(asset.UserID)
+	var moved []string
+	for _, name := range assetKeys(asset) {
+		err := moveObject(ctx, cfg.staging, stagingKey(userID, asset.BatchID, name), trashKey(userID, asset.BatchID, name))
+		if err != nil {
+			// Brak oryginału nie blokuje usunięcia - WebP wystarczy do przywrócenia
+			if errors.Is(err, storage.ErrNotFound) && name != asset.Filename {
+				continue
+			}
+			cfg.untrashObjects(ctx, asset, moved)
+			return fmt.Errorf("couldn't move %s to trash: %w", name, err)
+		}
+		moved = append(moved, name)
+	}
+	err := cfg.db.TrashStagedAsset(ctx, database.TrashStagedAssetParams{
+		Filename: asset.Filename,
+		UserID:   asset.UserID,
+	})
+	if err != nil {
+		cfg.untrashObjects(ctx, asset, moved)
+		return fmt.Errorf("couldn't mark staged asset as deleted: %w", err)
+	}
+	return nil
+}
+
+// untrashObjects cofa przeniesienie plików do kosza (wycofanie po błędzie)
+func (cfg *apiConfig) untrashObjects(ctx context.Context, asset database.StagedAsset, names []string) {
+	userID := int(asset.UserID)
+	for _, name := range names {
+		if err := moveObject(ctx, cfg.staging, trashKey(userID, asset.BatchID, name), stagingKey(userID, asset.BatchID, name)); err != nil {
+			log.Printf("Couldn't move %s back from trash: %v", name, err)
+		}
+	}
+}
+
+// restoreStagedAsset przywraca plik z kosza do jego partii; partię zakłada ponownie,
+// jeśli w międzyczasie została wysłana albo posprzątana
+func (cfg *apiConfig) restoreStagedAsset(ctx context.Context, asset database.StagedAsset) (database.StagedAsset, error) {
+	userID := int(asset.UserID)
+	if err := cfg.openBatch(ctx, userID, asset.BatchID); err != nil {
+		if !errors.Is(err, errBatchNotFound) {
+			return database.StagedAsset{}, err
+		}
+		err := cfg.staging.Put(ctx, stagingKey(userID, asset.BatchID, batchMarker), strings.NewReader(""), 0, "")
+		if err != nil {
+			return database.StagedAsset{}, fmt.Errorf("couldn't recreate batch: %w", err)
+		}
+	}
+	for _, name := range assetKeys(asset) {
+		err := moveObject(ctx, cfg.staging, trashKey(userID, asset.BatchID, name), stagingKey(userID, asset.BatchID, name))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) && name != asset.Filename {
+				continue
+			}
+			return database.StagedAsset{}, fmt.Errorf("couldn't restore %s: %w", name, err)
+		}
+	}
+	restored, err := cfg.db.RestoreStagedAsset(ctx, database.RestoreStagedAssetParams{
+		Filename: asset.Filename,
+		UserID:   asset.UserID,
+	})
+	if err != nil {
+		return database.StagedAsset{}, fmt.Errorf("couldn't restore staged asset: %w", err)
+	}
+	return restored, nil
+}
+
+// trashAssets przenosi do kosza podane wpisy; zwraca pierwszy błąd, ale próbuje wszystkie
+func (cfg *apiConfig) trashAssets(ctx context.Context, assets []database.StagedAsset) error {
+	var firstErr error
+	for _, asset := range assets {
+		if err := cfg.trashStagedAsset(ctx, asset); err != nil {
+			log.Printf("Couldn't trash %s: %v", asset.Filename, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// purgeTrash trwale usuwa pliki wrzucone do kosza przed cutoff
+func (cfg *apiConfig) purgeTrash(ctx context.Context, cutoff time.Time, run *JanitorRun) {
+	expired, err := cfg.db.ListTrashedAssetsDeletedBefore(ctx, &cutoff)
+	if err != nil {
+		log.Printf("Janitor: couldn't list expired trash: %v", err)
+		run.Errors++
+		return
+	}
+	for _, asset := range expired {
+		userID := int(asset.UserID)
+		var freed int64
+		var failed bool
+		for _, name := range assetKeys(asset) {
+			key := trashKey(userID, asset.BatchID, name)
+			if info, err := cfg.staging.Stat(ctx, key); err == nil {
+				freed += info.Size
+			}
+			if err := cfg.staging.Delete(ctx, key); err != nil {
+				log.Printf("Janitor: couldn't purge %s: %v", key, err)
+				failed = true
+			}
+		}
+		if failed {
+			run.Errors++
+			continue
+		}
+		if err := cfg.db.DeleteStagedAsset(ctx, asset.Filename); err != nil {
+			log.Printf("Janitor: couldn't delete trashed asset %s: %v", asset.Filename, err)
+			run.Errors++
+			continue
+		}
+		run.PurgedFiles++
+		run.FreedBytes += freed
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Tryb obserwowanego folderu (`goCmsAssistant watch`): nowe obrazki zapisane w WATCH_DIR
+// są przetwarzane presetem WATCH_PRESET do poczekalni użytkownika WATCH_USER,
+// a przy WATCH_AUTO_PUBLISH od razu wysyłane do WATCH_DESTINATION.
+// Oryginał trafia potem do WATCH_DIR/done albo WATCH_DIR/failed (z plikiem .error.txt).
+
+const (
+	watchDoneDir        = "done"
+	watchFailedDir      = "failed"
+	defaultWatchSettle  = 5 * time.Second
+	watchPollInterval   = time.Second
+	watchErrorExtension = ".error.txt"
+)
+
+type watchConfig struct {
+	dir         string
+	user        string
+	settings    uploadSettings
+	autoPublish bool
+	// settle to czas, przez który rozmiar pliku musi się nie zmieniać - zapis przez
+	// udział sieciowy przychodzi kawałkami i nie da się sprawdzić, czy plik jest jeszcze otwarty
+	settle time.Duration
+}
+
+// pendingFile to plik, który się pojawił, ale może być jeszcze zapisywany
+type pendingFile struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+}
+
+type folderWatcher struct {
+	cfg     *apiConfig
+	wc      watchConfig
+	userID  int
+	batchID string
+	pending map[string]*pendingFile
+}
+
+// runWatch to komenda "watch" - działa do SIGINT/SIGTERM
+func (cfg *apiConfig) runWatch(ctx context.Context) {
+	wc := cfg.watch
+	if wc.dir == "" {
+		log.Fatal("WATCH_DIR environment variable is not set")
+	}
+	if wc.user == "" {
+		log.Fatal("WATCH_USER environment variable is not set")
+	}
+	if wc.autoPublish && !WebsiteType(wc.settings.Destination).IsValid() {
+		log.Fatal("WATCH_DESTINATION must be 'tattoo' or '3d' when WATCH_AUTO_PUBLISH is enabled")
+	}
+	if _, _, err := cfg.resolvePipeline(ctx, wc.settings.Preset, wc.settings.Destination, wc.settings.AutoQuality); err != nil {
+		log.Fatalf("Invalid watch settings: %v", err)
+	}
+	user, err := cfg.db.GetUserByName(ctx, wc.user)
+	if err != nil {
+		log.Fatalf("Couldn't find WATCH_USER '%s': %v", wc.user, err)
+	}
+	for _, sub := range []string{watchDoneDir, watchFailedDir} {
+		if err := os.MkdirAll(filepath.Join(wc.dir, sub), 0755); err != nil {
+			log.Fatalf("Couldn't create %s directory: %v", sub, err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatalf("Couldn't start watcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(wc.dir); err != nil {
+		log.Fatalf("Couldn't watch %s: %v", wc.dir, err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fw := &folderWatcher{
+		cfg:     cfg,
+		wc:      wc,
+		userID:  int(user.ID),
+		pending: map[string]*pendingFile{},
+	}
+	// Pliki zapisane, gdy usługa nie działała
+	entries, err := os.ReadDir(wc.dir)
+	if err != nil {
+		log.Fatalf("Couldn't read %s: %v", wc.dir, err)
+	}
+	for _, entry := range entries {
+		fw.track(filepath.Join(wc.dir, entry.Name()))
+	}
+
+	log.Printf("Obserwuję %s (preset %s, użytkownik %s, autopublikacja: %v)", wc.dir, wc.settings.Preset, wc.user, wc.autoPublish)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Zatrzymano obserwowanie folderu")
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(fw.pending, event.Name)
+				continue
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				fw.track(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watch: %v", err)
+		case <-ticker.C:
+			if ready := fw.collectReady(time.Now()); len(ready) > 0 {
+				fw.process(ctx, ready)
+			}
+		}
+	}
+}
+
+// track dodaje plik do oczekujących (albo odświeża jego stan przy kolejnym zapisie)
+func (fw *folderWatcher) track(path string) {
+	name := filepath.Base(path)
+	if filepath.Dir(path) != filepath.Clean(fw.wc.dir) || strings.HasPrefix(name, ".") {
+		return
+	}
+	if _, ok := extensionMediaTypes[strings.ToLower(filepath.Ext(name))]; !ok {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	fw.pending[path] = &pendingFile{
+		size:        info.Size(),
+		modTime:     info.ModTime(),
+		stableSince: time.Now(),
+	}
+}
+
+// collectReady zwraca pliki, których rozmiar i czas modyfikacji nie zmieniły się od settle
+func (fw *folderWatcher) collectReady(now time.Time) []string {
+	var ready []string
+	for path, p := range fw.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(fw.pending, path)
+			continue
+		}
+		if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+			p.size = info.Size()
+			p.modTime = info.ModTime()
+			p.stableSince = now
+			continue
+		}
+		if p.size > 0 && now.Sub(p.stableSince) >= fw.wc.settle {
+			ready = append(ready, path)
+			delete(fw.pending, path)
+		}
+	}
+	return ready
+}
+
+// process przetwarza gotowe pliki pulą workerów, opcjonalnie publikuje partię
+// i przenosi oryginały do done/failed
+func (fw *folderWatcher) process(ctx context.Context, paths []string) {
+	cfg := fw.cfg
+	failAll := func(err error) {
+		log.Printf("Watch: %v", err)
+		for _, path := range paths {
+			fw.finish(path, err)
+		}
+	}
+
+	sources := make([]imageSource, len(paths))
+	var total int64
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			failAll(fmt.Errorf("couldn't stat %s: %w", path, err))
+			return
+		}
+		total += info.Size()
+		sources[i] = imageSource{
+			Name: filepath.Base(path),
+			Size: info.Size(),
+			open: func() (multipart.File, error) {
+				return os.Open(path)
+			},
+		}
+	}
+	if err := cfg.checkQuota(ctx, fw.userID, len(sources), total); err != nil {
+		failAll(err)
+		return
+	}
+
+	// Bez autopublikacji pliki zbierają się w jednej partii do przejrzenia w panelu,
+	// dopóki ktoś jej nie wyśle albo nie posprząta
+	if fw.batchID == "" || cfg.openBatch(ctx, fw.userID, fw.batchID) != nil {
+		batchID, err := cfg.createBatch(ctx, fw.userID)
+		if err != nil {
+			failAll(err)
+			return
+		}
+		fw.batchID = batchID
+	}
+	opts, err := cfg.processOptionsFor(ctx, fw.userID, fw.batchID, fw.wc.settings)
+	if err != nil {
+		failAll(err)
+		return
+	}
+
+	results := cfg.processSources(ctx, sources, opts)
+	for i, result := range results {
+		if result.Error == nil {
+			log.Printf("Watch: %s → %s", sources[i].Name, result.ImageInfo.Filename)
+		}
+	}
+
+	// Błędy wysyłki per plik WebP - oryginał z takim błędem też trafia do failed
+	publishErrs := map[string]error{}
+	if fw.wc.autoPublish {
+		published, err := cfg.publishBatch(ctx, fw.userID, fw.batchID, WebsiteType(fw.wc.settings.Destination))
+		fw.batchID = ""
+		if err != nil {
+			failAll(fmt.Errorf("couldn't publish batch: %w", err))
+			return
+		}
+		for _, p := range published {
+			if !p.Success {
+				publishErrs[p.Filename] = fmt.Errorf("publish failed: %s", p.Error)
+			}
+		}
+	}
+
+	for i, result := range results {
+		err := result.Error
+		if err == nil {
+			err = publishErrs[result.ImageInfo.Filename]
+		}
+		fw.finish(paths[i], err)
+	}
+}
+
+// finish przenosi oryginał do done albo failed; przy błędzie zapisuje obok jego opis
+func (fw *folderWatcher) finish(path string, procErr error) {
+	sub := watchDoneDir
+	if procErr != nil {
+		sub = watchFailedDir
+		log.Printf("Watch: %s failed: %v", filepath.Base(path), procErr)
+	}
+	dst := uniquePath(filepath.Join(fw.wc.dir, sub, filepath.Base(path)))
+	if err := os.Rename(path, dst); err != nil {
+		log.Printf("Watch: couldn't move %s to %s: %v", path, sub, err)
+		return
+	}
+	if procErr != nil {
+		if err := os.WriteFile(dst+watchErrorExtension, []byte(procErr.Error()+"\n"), 0644); err != nil {
+			log.Printf("Watch: couldn't write error file for %s: %v", dst, err)
+		}
+	}
+}
+
+// uniquePath dokleja licznik do nazwy, jeśli plik już istnieje (np. ten sam plik wrzucony drugi raz)
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// Pakiet XMP to XML osadzony w pliku bez zmian (segment APP1 JPEG-a, chunk iTXt PNG,
+// chunk "XMP " WebP, zasób PSD, tag TIFF), więc szukamy go po znacznikach początku i końca.
+
+var (
+	xmpPacketStart = []byte("<x:xmpmeta")
+	xmpPacketEnd   = []byte("</x:xmpmeta>")
+)
+
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+// Właściwości XMP, które nas interesują
+const (
+	xmpTitle       = "title"
+	xmpDescription = "description"
+	xmpSubject     = "subject"
+	xmpDateTaken   = "dateTaken"
+	xmpDateCreated = "dateCreated"
+	xmpModel       = "model"
+)
+
+var xmpProperties = map[xml.Name]string{
+	{Space: nsDC, Local: "title"}:              xmpTitle,
+	{Space: nsDC, Local: "description"}:        xmpDescription,
+	{Space: nsDC, Local: "subject"}:            xmpSubject,
+	{Space: nsEXIF, Local: "DateTimeOriginal"}: xmpDateTaken,
+	{Space: nsPhotoshop, Local: "DateCreated"}: xmpDateCreated,
+	{Space: nsTIFF, Local: "Model"}:            xmpModel,
+}
+
+type xmpValue struct {
+	lang string
+	text string
+}
+
+// findXMPPacket zwraca pakiet XMP albo nil
+func findXMPPacket(data []byte) []byte {
+	start := bytes.Index(data, xmpPacketStart)
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], xmpPacketEnd)
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len(xmpPacketEnd)]
+}
+
+// parseXMP czyta właściwości zapisane jako elementy (także listy rdf:Alt/rdf:Bag)
+// i jako atrybuty rdf:Description
+func parseXMP(packet []byte) captureMetadata {
+	var m captureMetadata
+	if packet == nil {
+		return m
+	}
+	values := map[string][]xmpValue{}
+
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+	var current, lang string
+	var text strings.Builder
+	inItem := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Space == nsRDF && tok.Name.Local == "Description" {
+				for _, attr := range tok.Attr {
+					if prop, ok := xmpProperties[attr.Name]; ok {
+						values[prop] = append(values[prop], xmpValue{text: strings.TrimSpace(attr.Value)})
+					}
+				}
+				continue
+			}
+			if prop, ok := xmpProperties[tok.Name]; ok && current == "" {
+				current = prop
+				text.Reset()
+				continue
+			}
+			if current != "" && tok.Name.Space == nsRDF && tok.Name.Local == "li" {
+				inItem = true
+				lang = ""
+				for _, attr := range tok.Attr {
+					if attr.Name.Local == "lang" {
+						lang = attr.Value
+					}
+				}
+				text.Reset()
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if current == "" {
+				continue
+			}
+			if inItem && tok.Name.Space == nsRDF && tok.Name.Local == "li" {
+				values[current] = append(values[current], xmpValue{lang: lang, text: strings.TrimSpace(text.String())})
+				inItem = false
+				text.Reset()
+				continue
+			}
+			if prop, ok := xmpProperties[tok.Name]; ok && prop == current {
+				// Prosta właściwość bez listy
+				if len(values[current]) == 0 {
+					if s := strings.TrimSpace(text.String()); s != "" {
+						values[current] = append(values[current], xmpValue{text: s})
+					}
+				}
+				current = ""
+			}
+		}
+	}
+
+	m.Title = xmpDefault(values[xmpTitle])
+	m.Caption = xmpDefault(values[xmpDescription])
+	m.CameraModel = xmpDefault(values[xmpModel])
+	for _, v := range values[xmpSubject] {
+		m.Keywords = append(m.Keywords, v.text)
+	}
+	for _, prop := range []string{xmpDateTaken, xmpDateCreated} {
+		if t := xmpTime(values[prop]); t != nil {
+			m.CapturedAt = t
+			break
+		}
+	}
+	return m
+}
+
+// xmpDefault wybiera wariant "x-default" z listy językowej, a bez niego pierwszy niepusty
+func xmpDefault(values []xmpValue) string {
+	for _, v := range values {
+		if v.lang == "x-default" && v.text != "" {
+			return v.text
+		}
+	}
+	for _, v := range values {
+		if v.text != "" {
+			return v.text
+		}
+	}
+	return ""
+}
+
+func xmpTime(values []xmpValue) *time.Time {
+	for _, v := range values {
+		if t := parseCaptureTime(v.text); t != nil {
+			return t
+		}
+	}
+	return nil
+}